@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/ledgerio"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/report"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
+)
+
+// 命令行子命令，便于脚本调用，例如：
+//
+//	go run . report -addr <地址1>,<地址2> -period month -format csv
+//	go run . export -what chain -format json -o chain.json
+//	go run . prune -depth 1000
+//	go run . exportchain -o chain.abk
+//	go run . backup ./database/backup.db
+//	go run . verifychain -level 3
+//	go run . loadutxo -in utxo.abs -hash <承诺哈希> -db ./database/new.db
+//	go run . import -in rows.csv -keys keys.txt -dry-run
+//	go run . miner start -addr <地址> -rpc 127.0.0.1:8765
+//	go run . miner status -rpc 127.0.0.1:8765
+//	go run . batchpay -from <地址> -keys keys.txt -to <地址1>:10,<地址2>:2.5
+func runCommand(args []string) error {
+	// miner status/stop 经RPC访问运行中的矿工进程，数据库已被该进程打开
+	if args[0] == "miner" {
+		return cmdMiner(args[1:])
+	}
+	ab = accountbook.NewAccountBook(dbPath)
+	switch args[0] {
+	case "report":
+		return cmdReport(args[1:])
+	case "export":
+		return cmdExport(args[1:])
+	case "prune":
+		return cmdPrune(args[1:])
+	case "exportchain":
+		return cmdExportChain(args[1:])
+	case "importchain":
+		return cmdImportChain(args[1:])
+	case "dumputxo":
+		return cmdDumpUTXO(args[1:])
+	case "loadutxo":
+		return cmdLoadUTXO(args[1:])
+	case "verifyhistory":
+		return cmdVerifyHistory(args[1:])
+	case "backup":
+		return cmdBackup(args[1:])
+	case "verifychain":
+		return cmdVerifyChain(args[1:])
+	case "import":
+		return cmdImport(args[1:])
+	case "batchpay":
+		return cmdBatchPay(args[1:])
+	default:
+		return fmt.Errorf("未知命令: %s", args[0])
+	}
+}
+
+// 生成账目报表
+func cmdReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	addrs := fs.String("addr", "", "逗号分隔的地址列表")
+	period := fs.String("period", string(report.Monthly), "余额统计周期：day 或 month")
+	format := fs.String("format", string(report.FormatText), "输出格式：text、csv 或 json")
+	top := fs.Int("top", 10, "列出的对手方数量，0表示全部")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *addrs == "" {
+		return errors.New("请使用 -addr 指定地址")
+	}
+	r, err := report.New(ab, strings.Split(*addrs, ","), report.Period(*period), *top)
+	if err != nil {
+		return err
+	}
+	return r.Write(os.Stdout, report.Format(*format))
+}
+
+// 导出地址历史或整条区块链
+func cmdExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	what := fs.String("what", "history", "导出内容：history（地址历史）或 chain（整条链）")
+	addrs := fs.String("addr", "", "逗号分隔的地址列表，导出history时必填")
+	format := fs.String("format", ledgerio.FormatCSV, "导出格式：csv 或 json")
+	output := fs.String("o", "", "输出文件，留空输出到标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	switch *what {
+	case "history":
+		if *addrs == "" {
+			return errors.New("请使用 -addr 指定地址")
+		}
+		return ledgerio.ExportHistory(out, ab, strings.Split(*addrs, ","), *format)
+	case "chain":
+		return ledgerio.ExportChain(out, ab, *format)
+	default:
+		return fmt.Errorf("未知的导出内容: %s", *what)
+	}
+}
+
+// 裁剪旧区块，只保留区块头与未花费输出集合
+// 裁剪设置保存在数据库中，之后接入的区块（包括交互模式下）按同一设置自动裁剪
+func cmdPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	depth := fs.Int("depth", 0, "保留最近多少个区块的完整内容")
+	size := fs.Int("size", 0, "保留完整内容的区块总字节数上限")
+	off := fs.Bool("off", false, "停止自动裁剪，已裁剪的区块不会恢复")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *off {
+		if err := ab.Chain.SetPrune(nil); err != nil {
+			return err
+		}
+		fmt.Println("已停止自动裁剪")
+		return nil
+	}
+	if *depth <= 0 && *size <= 0 {
+		return errors.New("请使用 -depth 或 -size 指定保留范围，或使用 -off 停止裁剪")
+	}
+	if err := ab.Chain.SetPrune(&blockchain.PruneConfig{Depth: *depth, MaxSize: *size}); err != nil {
+		return err
+	}
+	n, err := ab.Chain.PruneBlocks()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已裁剪%d个区块，高度低于%d的区块只保留区块头；之后接入的区块按此设置自动裁剪\n", n, ab.Chain.PruneHeight())
+	return nil
+}
+
+// 导出整条链到区块文件
+func cmdExportChain(args []string) error {
+	fs := flag.NewFlagSet("exportchain", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("请使用 -o 指定输出文件")
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ab.Chain.ExportChain(f); err != nil {
+		return err
+	}
+	fmt.Printf("已导出%d个区块\n", len(ab.Chain.GetBlocks()))
+	return nil
+}
+
+// 从区块文件导入区块，每个区块经过完整校验
+func cmdImportChain(args []string) error {
+	fs := flag.NewFlagSet("importchain", flag.ContinueOnError)
+	input := fs.String("in", "", "区块文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("请使用 -in 指定区块文件")
+	}
+	f, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := ab.Chain.ImportChain(f)
+	fmt.Printf("已导入%d个区块\n", n)
+	return err
+}
+
+// 写出未花费输出快照并打印其承诺哈希
+func cmdDumpUTXO(args []string) error {
+	fs := flag.NewFlagSet("dumputxo", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("请使用 -o 指定输出文件")
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	commitment, err := ab.Chain.WriteUTXOSnapshot(f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("快照高度: %d\n承诺哈希: %x\n", len(ab.Chain.GetBlocks())-1, commitment)
+	return nil
+}
+
+// 从可信的未花费输出快照创建新的数据库
+func cmdLoadUTXO(args []string) error {
+	fs := flag.NewFlagSet("loadutxo", flag.ContinueOnError)
+	input := fs.String("in", "", "快照文件")
+	hash := fs.String("hash", "", "可信的承诺哈希")
+	dbPath := fs.String("db", "", "新数据库路径，须不存在")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || *dbPath == "" {
+		return errors.New("请使用 -in 与 -db 指定快照文件与新数据库路径")
+	}
+	var trusted [32]byte
+	b, err := hex.DecodeString(*hash)
+	if err != nil || len(b) != len(trusted) {
+		return errors.New("请使用 -hash 指定64位十六进制的承诺哈希")
+	}
+	copy(trusted[:], b)
+	if _, err := os.Stat(*dbPath); err == nil {
+		return fmt.Errorf("数据库 %s 已存在", *dbPath)
+	}
+	f, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	store, err := db.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	chain, err := blockchain.NewBlockchainFromSnapshot(store, f, trusted, ab.Chain.Net)
+	if err != nil {
+		store.Close()
+		os.Remove(*dbPath)
+		return err
+	}
+	defer chain.Close()
+	fmt.Printf("已从快照创建 %s，链尾高度%d；可用 verifyhistory 验证之前的历史\n", *dbPath, len(chain.GetBlocks())-1)
+	return nil
+}
+
+// 用区块文件在后台验证由快照启动的链的历史
+func cmdVerifyHistory(args []string) error {
+	fs := flag.NewFlagSet("verifyhistory", flag.ContinueOnError)
+	input := fs.String("in", "", "区块文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("请使用 -in 指定区块文件")
+	}
+	if err := <-ab.VerifyHistoryInBackground(*input); err != nil {
+		return err
+	}
+	info, _, err := ab.Chain.Snapshot()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("快照高度%d之前的历史验证通过\n", info.Height)
+	return nil
+}
+
+// 备份数据库到新文件
+func cmdBackup(args []string) error {
+	if len(args) != 1 {
+		return errors.New("用法: backup <备份文件路径>")
+	}
+	n, err := backupDatabase(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已备份%d字节到 %s\n", n, args[0])
+	return nil
+}
+
+// 在一致的只读视图上备份数据库，不覆盖已有文件，失败时删除不完整的备份
+func backupDatabase(path string) (int64, error) {
+	if path == "" {
+		return 0, errors.New("未指定备份文件路径")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ab.Chain.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	return n, nil
+}
+
+// 按级别重新检查存储的区块链，报告第一个有问题的区块
+func cmdVerifyChain(args []string) error {
+	fs := flag.NewFlagSet("verifychain", flag.ContinueOnError)
+	level := fs.Int("level", blockchain.VerifyUTXO, "校验级别：0区块头 1Merkle根 2签名 3未花费输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := ab.Chain.VerifyChain(*level); err != nil {
+		return err
+	}
+	fmt.Printf("校验通过（级别%d，%d个区块）\n", *level, len(ab.Chain.GetBlocks()))
+	return nil
+}
+
+// 从CSV批量导入转账，打印每行的结果；签名所用的钱包从私钥文件加载
+func cmdImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	input := fs.String("in", "", "CSV文件，每行格式为 from,to,amount,memo")
+	keys := fs.String("keys", "", "私钥文件，每行一个十六进制私钥")
+	dryRun := fs.Bool("dry-run", false, "只校验不上链")
+	batch := fs.Int("batch", 50, "每个区块最多打包的交易数")
+	miner := fs.String("miner", "", "打包区块的Coinbase奖励地址")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("请使用 -in 指定CSV文件")
+	}
+	if err := loadWallets(*keys); err != nil {
+		return err
+	}
+	f, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	opts := ledgerio.ImportOptions{DryRun: *dryRun, BatchSize: *batch, MinerAddress: *miner}
+	results, err := ledgerio.ImportCSV(ab, f, findWallet, opts)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("第%d行 失败: %v\n", r.Row.Line, r.Err)
+		case opts.DryRun:
+			fmt.Printf("第%d行 校验通过: %s -> %s %s %s\n", r.Row.Line, r.Row.From, r.Row.To, r.Row.Amount, r.Row.Memo)
+		default:
+			fmt.Printf("第%d行 已打包进区块 #%d，交易ID: %s %s\n", r.Row.Line, r.Height, r.TxID, r.Row.Memo)
+		}
+	}
+	fmt.Printf("共%d行，成功%d行，失败%d行\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d行导入失败", failed)
+	}
+	return nil
+}
+
+// 批量付款：一笔交易支付多个收款方，收款方来自 -to 或每行“地址 金额”的文件
+func cmdBatchPay(args []string) error {
+	fs := flag.NewFlagSet("batchpay", flag.ContinueOnError)
+	from := fs.String("from", "", "转出地址")
+	keys := fs.String("keys", "", "私钥文件，每行一个十六进制私钥")
+	to := fs.String("to", "", "逗号分隔的收款方，每项为 地址:金额")
+	input := fs.String("in", "", "收款方文件，每行为 地址 金额")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := loadWallets(*keys); err != nil {
+		return err
+	}
+	w := findWallet(*from)
+	if w == nil {
+		return errors.New("请使用 -from 指定转出地址，并用 -keys 加载其私钥")
+	}
+	var items [][]string
+	if *to != "" {
+		for _, item := range strings.Split(*to, ",") {
+			items = append(items, strings.Split(item, ":"))
+		}
+	}
+	if *input != "" {
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				items = append(items, fields)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return errors.New("请使用 -to 或 -in 指定收款方")
+	}
+	payments := make([]utxo.Payment, 0, len(items))
+	for i, item := range items {
+		if len(item) != 2 {
+			return fmt.Errorf("第%d个收款方格式错误: %s", i+1, strings.Join(item, " "))
+		}
+		amount, err := tx.ParseAmount(item[1])
+		if !wallet.ValidateAddress(item[0]) || err != nil || amount <= 0 {
+			return fmt.Errorf("第%d个收款方的地址或金额无效: %s", i+1, strings.Join(item, " "))
+		}
+		payments = append(payments, utxo.Payment{To: item[0], Amount: amount})
+	}
+
+	newTx, err := ab.CreateBatchTransaction(*from, payments, w, feeOption())
+	if err != nil {
+		return err
+	}
+	if err := commitTx(newTx); err != nil {
+		return err
+	}
+	fmt.Printf("批量付款交易（%d个收款方）ID: %x\n", len(payments), newTx.ID)
+	return nil
+}
+
+// 从私钥文件加载钱包到walletList，空行与#开头的行被忽略；path为空时不加载
+func loadWallets(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		w, err := wallet.NewWalletFromKey(line)
+		if err != nil {
+			return fmt.Errorf("%s 第%d行: %w", path, i+1, err)
+		}
+		walletList = append(walletList, w)
+	}
+	return nil
+}
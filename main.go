@@ -2,14 +2,21 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/ledgerio"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/report"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
 )
 
 var (
@@ -17,10 +24,20 @@ var (
 	walletList []*wallet.Wallet
 )
 
+const dbPath = "./database/data.db"
+
 func main() {
-	ab = accountbook.NewAccountBook("./database/data.db")
 	walletList = []*wallet.Wallet{}
 
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	ab = accountbook.NewAccountBook(dbPath)
+
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Println("\n==== 区块链账本菜单 ====")
@@ -31,6 +48,15 @@ func main() {
 		fmt.Println("5. 添加Coinbase交易")
 		fmt.Println("6. 查看所有交易")
 		fmt.Println("7. 打印区块链")
+		fmt.Println("8. 生成账目报表")
+		fmt.Println("9. 从CSV批量导入转账")
+		fmt.Println("10. 批量付款（一笔交易多个收款方）")
+		fmt.Println("11. 多钱包共同付款")
+		fmt.Println("12. 合并零散UTXO")
+		fmt.Println("13. 后台挖矿（启动/停止/状态）")
+		fmt.Println("14. 提高交易池中交易的手续费")
+		fmt.Println("15. 取消交易池中的交易")
+		fmt.Println("16. 备份/校验数据库")
 		fmt.Println("0. 退出")
 		fmt.Print("请选择操作: ")
 
@@ -42,6 +68,7 @@ func main() {
 			w := ab.NewWallet()
 			walletList = append(walletList, w)
 			fmt.Println("新钱包已创建，地址：", ab.GetAddress(w))
+			fmt.Println("私钥（命令行子命令用 -keys 文件加载，请妥善保管）：", w.PrivateKeyHex())
 		case "2":
 			if len(walletList) == 0 {
 				fmt.Println("暂无钱包，请先创建。")
@@ -54,8 +81,12 @@ func main() {
 		case "3":
 			fmt.Print("请输入钱包编号或地址: ")
 			addr := readWalletAddr(reader)
-			balance := ab.GetBalance(addr)
-			fmt.Printf("地址 %s 的余额为: %d\n", addr, balance)
+			balance := ab.GetBalances(addr)
+			fmt.Printf("地址 %s 的余额为: %s\n", addr, balance.Total())
+			fmt.Printf("  已确认: %s\n  待确认: %s\n  未成熟: %s\n", balance.Confirmed, balance.Unconfirmed, balance.Immature)
+			if pending := ab.PendingTransactions(addr); len(pending) > 0 {
+				fmt.Printf("  交易池中有%d笔相关交易待确认\n", len(pending))
+			}
 		case "4":
 			if len(walletList) < 1 {
 				fmt.Println("请先创建钱包。")
@@ -69,21 +100,36 @@ func main() {
 			}
 			fmt.Print("请输入收款地址: ")
 			toAddr := readWalletAddr(reader)
-			fmt.Print("请输入转账金额: ")
+			fmt.Print("请输入转账金额（如12.34）: ")
 			amountStr, _ := reader.ReadString('\n')
-			amountStr = strings.TrimSpace(amountStr)
-			amount, err := strconv.Atoi(amountStr)
+			amount, err := tx.ParseAmount(amountStr)
 			if err != nil || amount <= 0 {
 				fmt.Println("金额无效。")
 				continue
 			}
-			newTx, err := ab.CreateTransaction(ab.GetAddress(walletList[fromIdx]), toAddr, amount, walletList[fromIdx])
+			fmt.Print("请选择选币策略（1.最大优先 2.最小优先 3.精确匹配 4.随机改进，默认按链上顺序）: ")
+			selector := readCoinSelector(reader)
+			fmt.Print("请输入锁定时间（区块高度或Unix时间戳，直接回车表示不锁定）: ")
+			lockTime, ok := readLockTime(reader)
+			if !ok {
+				fmt.Println("锁定时间无效。")
+				continue
+			}
+			opts := []utxo.TxOption{utxo.WithCoinSelector(selector), utxo.WithLockTime(lockTime), feeOption()}
+			fmt.Print("是否允许之后提高手续费或取消（y/N）: ")
+			if answer, _ := reader.ReadString('\n'); strings.EqualFold(strings.TrimSpace(answer), "y") {
+				opts = append(opts, utxo.WithReplaceable())
+			}
+			newTx, err := ab.CreateTransaction(ab.GetAddress(walletList[fromIdx]), toAddr, amount, walletList[fromIdx], opts...)
 			if err != nil {
 				fmt.Println("转账失败：", err)
 				continue
 			}
-			ab.AddBlock([]*tx.Transaction{newTx}, "")
-			fmt.Println("转账交易已打包进新区块，交易ID:", fmt.Sprintf("%x", newTx.ID))
+			if err := commitTx(newTx); err != nil {
+				fmt.Println("转账失败：", err)
+				continue
+			}
+			fmt.Println("转账交易ID:", fmt.Sprintf("%x", newTx.ID))
 		case "5":
 			fmt.Print("请输入接收Coinbase奖励的钱包编号: ")
 			idx := readWalletIndex(reader)
@@ -92,14 +138,36 @@ func main() {
 				continue
 			}
 			cbTx := ab.NewCoinbaseTx(ab.GetAddress(walletList[idx]), "")
-			ab.AddBlock([]*tx.Transaction{cbTx}, "")
+			if err := ab.AddBlock([]*tx.Transaction{cbTx}, ""); err != nil {
+				fmt.Println("添加Coinbase交易失败：", err)
+				continue
+			}
 			fmt.Println("Coinbase交易已添加。")
 		case "6":
 			fmt.Println("区块链所有交易：")
 			printAllTransactions()
 		case "7":
 			ab.PrintChain()
+		case "8":
+			printReport(reader)
+		case "9":
+			importCSV(reader)
+		case "10":
+			batchPay(reader)
+		case "11":
+			multiWalletPay(reader)
+		case "12":
+			consolidate(reader)
+		case "13":
+			manageMiner(reader)
+		case "14":
+			bumpFee(reader)
+		case "15":
+			cancelTx(reader)
+		case "16":
+			maintainDatabase(reader)
 		case "0":
+			ab.StopMiner()
 			fmt.Println("退出程序。")
 			return
 		default:
@@ -108,6 +176,110 @@ func main() {
 	}
 }
 
+// 提交交易：后台矿工运行时放入交易池等待打包，否则立即打包进新区块
+func commitTx(t *tx.Transaction) error {
+	if ab.MinerRunning() {
+		if err := ab.SubmitTx(t); err != nil {
+			return err
+		}
+		fmt.Println("交易已提交到交易池，等待后台矿工打包。")
+		return nil
+	}
+	if err := ab.AddBlock([]*tx.Transaction{t}, ""); err != nil {
+		return err
+	}
+	if ab.FindTransaction(t.ID) == nil {
+		if !ab.Pool.HasTx(t.ID) {
+			return errors.New("交易未通过校验，未能打包")
+		}
+		fmt.Println("交易尚未生效（锁定时间未到或花费的挖矿奖励未成熟），已放入交易池，生效后随之后的区块打包。")
+		return nil
+	}
+	fmt.Println("交易已打包进新区块。")
+	return nil
+}
+
+// 读取锁定时间，直接回车表示不锁定
+func readLockTime(reader *bufio.Reader) (uint32, bool) {
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return 0, true
+	}
+	lockTime, err := strconv.ParseUint(input, 10, 32)
+	return uint32(lockTime), err == nil
+}
+
+// 后台矿工运行时交易需进入交易池，按最低转发费率附加手续费
+func feeOption() utxo.TxOption {
+	if ab.MinerRunning() {
+		return utxo.WithFeeRate(blockchain.DefaultPolicy.MinRelayFeePerKB)
+	}
+	return utxo.WithFee(0)
+}
+
+// 启动、停止后台矿工或查看其状态
+func manageMiner(reader *bufio.Reader) {
+	fmt.Print("请选择（1.启动 2.停止 3.状态）: ")
+	input, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(input) {
+	case "1":
+		fmt.Print("请输入接收挖矿奖励的钱包编号或地址: ")
+		addr := readWalletAddr(reader)
+		if err := ab.StartMiner(addr); err != nil {
+			fmt.Println("启动失败：", err)
+			return
+		}
+		fmt.Println("后台矿工已启动，转账将提交到交易池。")
+	case "2":
+		ab.StopMiner()
+		fmt.Println("后台矿工已停止。")
+	case "3":
+		if ab.Miner == nil {
+			fmt.Println("后台矿工未启动。")
+			return
+		}
+		printMinerStatus(newMinerStatus(ab.Miner.Status()))
+	default:
+		fmt.Println("无效操作。")
+	}
+}
+
+// 运行期间数据库被本进程锁定，备份与校验只能在这里进行
+func maintainDatabase(reader *bufio.Reader) {
+	fmt.Print("请选择（1.备份 2.校验）: ")
+	input, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(input) {
+	case "1":
+		fmt.Print("请输入备份文件路径: ")
+		path, _ := reader.ReadString('\n')
+		n, err := backupDatabase(strings.TrimSpace(path))
+		if err != nil {
+			fmt.Println("备份失败：", err)
+			return
+		}
+		fmt.Printf("已备份%d字节。\n", n)
+	case "2":
+		fmt.Printf("请输入校验级别（0.区块头 1.Merkle根 2.签名 3.未花费输出，默认%d）: ", blockchain.VerifyUTXO)
+		input, _ := reader.ReadString('\n')
+		level := blockchain.VerifyUTXO
+		if s := strings.TrimSpace(input); s != "" {
+			var err error
+			if level, err = strconv.Atoi(s); err != nil {
+				fmt.Println("无效的校验级别。")
+				return
+			}
+		}
+		if err := ab.Chain.VerifyChain(level); err != nil {
+			fmt.Println("校验失败：", err)
+			return
+		}
+		fmt.Println("校验通过。")
+	default:
+		fmt.Println("无效操作。")
+	}
+}
+
 // 辅助函数：读取钱包地址或编号
 func readWalletAddr(reader *bufio.Reader) string {
 	input, _ := reader.ReadString('\n')
@@ -130,12 +302,309 @@ func readWalletIndex(reader *bufio.Reader) int {
 	return idx
 }
 
-// 打印所有区块链上的交易
+// 辅助函数：读取选币策略
+func readCoinSelector(reader *bufio.Reader) utxo.CoinSelector {
+	input, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(input) {
+	case "1":
+		return utxo.LargestFirst{}
+	case "2":
+		return utxo.SmallestFirst{}
+	case "3":
+		return utxo.BranchAndBound{}
+	case "4":
+		return utxo.RandomImprove{}
+	default:
+		return utxo.ChainOrder{}
+	}
+}
+
+// 打印所有区块链上的交易，已裁剪的区块只提示范围
 func printAllTransactions() {
-	for i, block := range ab.Chain.Blocks {
+	pruned := ab.Chain.PruneHeight()
+	if pruned > 0 {
+		fmt.Printf("区块 #0-#%d 已被裁剪，只显示之后的交易。\n", pruned-1)
+	}
+	for i, block := range ab.Chain.GetBlocks() {
+		if i < pruned {
+			continue
+		}
 		fmt.Printf("区块 #%d:\n", i)
 		for _, t := range block.Transactions {
 			t.PrintDetails()
 		}
 	}
 }
+
+// 交互式生成账目报表
+func printReport(reader *bufio.Reader) {
+	fmt.Print("请输入钱包编号或地址（逗号分隔，留空为所有钱包）: ")
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	var addresses []string
+	if input == "" {
+		for _, w := range walletList {
+			addresses = append(addresses, ab.GetAddress(w))
+		}
+	} else {
+		for _, item := range strings.Split(input, ",") {
+			item = strings.TrimSpace(item)
+			if idx, err := strconv.Atoi(item); err == nil && idx >= 0 && idx < len(walletList) {
+				item = ab.GetAddress(walletList[idx])
+			}
+			addresses = append(addresses, item)
+		}
+	}
+	fmt.Print("请输入余额统计周期（day/month，默认month）: ")
+	period, _ := reader.ReadString('\n')
+	period = strings.TrimSpace(period)
+	if period == "" {
+		period = string(report.Monthly)
+	}
+	fmt.Print("请输入输出格式（text/csv/json，默认text）: ")
+	format, _ := reader.ReadString('\n')
+	format = strings.TrimSpace(format)
+	if format == "" {
+		format = string(report.FormatText)
+	}
+
+	r, err := report.New(ab, addresses, report.Period(period), 10)
+	if err != nil {
+		fmt.Println("生成报表失败：", err)
+		return
+	}
+	if err := r.Write(os.Stdout, report.Format(format)); err != nil {
+		fmt.Println("输出报表失败：", err)
+	}
+}
+
+// 从CSV批量导入转账，每行格式为 from,to,amount,memo
+func importCSV(reader *bufio.Reader) {
+	fmt.Print("请输入CSV文件路径: ")
+	path, _ := reader.ReadString('\n')
+	path = strings.TrimSpace(path)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Println("打开文件失败：", err)
+		return
+	}
+	defer f.Close()
+	fmt.Print("是否仅试运行（y/N）: ")
+	dry, _ := reader.ReadString('\n')
+	opts := ledgerio.ImportOptions{
+		DryRun:    strings.EqualFold(strings.TrimSpace(dry), "y"),
+		BatchSize: 50,
+	}
+
+	results, err := ledgerio.ImportCSV(ab, f, findWallet, opts)
+	if err != nil {
+		fmt.Println("导入失败：", err)
+		return
+	}
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("第%d行 失败: %v\n", r.Row.Line, r.Err)
+		case opts.DryRun:
+			fmt.Printf("第%d行 校验通过: %s -> %s %s %s\n", r.Row.Line, r.Row.From, r.Row.To, r.Row.Amount, r.Row.Memo)
+		default:
+			fmt.Printf("第%d行 已打包进区块 #%d，交易ID: %s %s\n", r.Row.Line, r.Height, r.TxID, r.Row.Memo)
+		}
+	}
+	fmt.Printf("共%d行，成功%d行，失败%d行。\n", len(results), len(results)-failed, failed)
+}
+
+// 提高交易池中交易的手续费（RBF）
+func bumpFee(reader *bufio.Reader) {
+	txid, w := readPoolTx(reader)
+	if w == nil {
+		return
+	}
+	fmt.Print("请输入新的费率（每1000字节的金额，直接回车使用最低要求）: ")
+	input, _ := reader.ReadString('\n')
+	var feeRate tx.Amount
+	if input = strings.TrimSpace(input); input != "" {
+		var err error
+		if feeRate, err = tx.ParseAmount(input); err != nil || feeRate < 0 {
+			fmt.Println("费率无效。")
+			return
+		}
+	}
+	newTx, err := ab.BumpFee(txid, w, feeRate)
+	if err != nil {
+		fmt.Println("提高手续费失败：", err)
+		return
+	}
+	fmt.Printf("替换交易已提交，手续费%s，交易ID: %x\n", ab.Pool.TxFee(ab.Chain, newTx), newTx.ID)
+}
+
+// 取消交易池中的交易（RBF）
+func cancelTx(reader *bufio.Reader) {
+	txid, w := readPoolTx(reader)
+	if w == nil {
+		return
+	}
+	newTx, err := ab.CancelTx(txid, w)
+	if err != nil {
+		fmt.Println("取消失败：", err)
+		return
+	}
+	fmt.Printf("取消交易已提交，资金将退回原钱包，交易ID: %x\n", newTx.ID)
+}
+
+// 读取交易池中交易的ID，并找到其输入所属的钱包
+func readPoolTx(reader *bufio.Reader) ([]byte, *wallet.Wallet) {
+	fmt.Print("请输入交易ID: ")
+	input, _ := reader.ReadString('\n')
+	txid, err := hex.DecodeString(strings.TrimSpace(input))
+	if err != nil {
+		fmt.Println("交易ID无效。")
+		return nil, nil
+	}
+	t := ab.Pool.GetTx(txid)
+	if t == nil {
+		fmt.Println("交易不在交易池中。")
+		return nil, nil
+	}
+	for _, w := range walletList {
+		if bytes.Equal(w.PublicKey, t.Inputs[0].PubKey) {
+			return txid, w
+		}
+	}
+	fmt.Println("找不到该交易对应的钱包。")
+	return nil, nil
+}
+
+// 根据地址查找已创建的钱包
+func findWallet(address string) *wallet.Wallet {
+	for _, w := range walletList {
+		if ab.GetAddress(w) == address {
+			return w
+		}
+	}
+	return nil
+}
+
+// 批量付款：逐行输入“收款地址 金额”，空行结束
+func batchPay(reader *bufio.Reader) {
+	if len(walletList) < 1 {
+		fmt.Println("请先创建钱包。")
+		return
+	}
+	fmt.Print("请输入转出钱包编号: ")
+	fromIdx := readWalletIndex(reader)
+	if fromIdx < 0 || fromIdx >= len(walletList) {
+		fmt.Println("钱包编号无效。")
+		return
+	}
+	payments := readPayments(reader)
+	if len(payments) == 0 {
+		fmt.Println("没有收款方。")
+		return
+	}
+
+	from := walletList[fromIdx]
+	newTx, err := ab.CreateBatchTransaction(ab.GetAddress(from), payments, from, feeOption())
+	if err != nil {
+		fmt.Println("批量付款失败：", err)
+		return
+	}
+	if err := commitTx(newTx); err != nil {
+		fmt.Println("批量付款失败：", err)
+		return
+	}
+	fmt.Printf("批量付款交易（%d个收款方）ID: %x\n", len(payments), newTx.ID)
+}
+
+// 多钱包共同付款：输入来自多个钱包，分别签名
+func multiWalletPay(reader *bufio.Reader) {
+	fmt.Print("请输入出资钱包编号（逗号分隔）: ")
+	input, _ := reader.ReadString('\n')
+	var wallets []*wallet.Wallet
+	for _, item := range strings.Split(strings.TrimSpace(input), ",") {
+		idx, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || idx < 0 || idx >= len(walletList) {
+			fmt.Println("钱包编号无效：", item)
+			return
+		}
+		wallets = append(wallets, walletList[idx])
+	}
+	fmt.Print("请输入找零钱包编号或地址（留空为第一个出资钱包）: ")
+	change := readWalletAddr(reader)
+	if change == "" {
+		change = ab.GetAddress(wallets[0])
+	}
+	if !wallet.ValidateAddress(change) {
+		fmt.Println("找零地址无效。")
+		return
+	}
+	payments := readPayments(reader)
+	if len(payments) == 0 {
+		fmt.Println("没有收款方。")
+		return
+	}
+
+	newTx, err := ab.CreateMultiWalletTransaction(wallets, payments, change, feeOption())
+	if err != nil {
+		fmt.Println("付款失败：", err)
+		return
+	}
+	if err := commitTx(newTx); err != nil {
+		fmt.Println("付款失败：", err)
+		return
+	}
+	fmt.Printf("多钱包付款交易（%d个输入）ID: %x\n", len(newTx.Inputs), newTx.ID)
+}
+
+// 合并某钱包的零散UTXO
+func consolidate(reader *bufio.Reader) {
+	fmt.Print("请输入钱包编号: ")
+	idx := readWalletIndex(reader)
+	if idx < 0 || idx >= len(walletList) {
+		fmt.Println("钱包编号无效。")
+		return
+	}
+	fmt.Print("最多合并的UTXO数量（留空为全部）: ")
+	maxInputs := readWalletIndex(reader)
+
+	w := walletList[idx]
+	newTx, err := ab.Consolidate(ab.GetAddress(w), w, maxInputs, feeOption())
+	if err != nil {
+		fmt.Println("合并失败：", err)
+		return
+	}
+	if err := commitTx(newTx); err != nil {
+		fmt.Println("合并失败：", err)
+		return
+	}
+	fmt.Printf("合并%d个UTXO的交易ID: %x\n", len(newTx.Inputs), newTx.ID)
+}
+
+// 逐行读取“收款钱包编号或地址 金额”，空行结束
+func readPayments(reader *bufio.Reader) []utxo.Payment {
+	fmt.Println("请逐行输入“收款钱包编号或地址 金额”，空行结束：")
+	var payments []utxo.Payment
+	for {
+		line, _ := reader.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return payments
+		}
+		if len(fields) != 2 {
+			fmt.Println("格式错误，已忽略该行。")
+			continue
+		}
+		to := fields[0]
+		if idx, err := strconv.Atoi(to); err == nil && idx >= 0 && idx < len(walletList) {
+			to = ab.GetAddress(walletList[idx])
+		}
+		amount, err := tx.ParseAmount(fields[1])
+		if !wallet.ValidateAddress(to) || err != nil || amount <= 0 {
+			fmt.Println("地址或金额无效，已忽略该行。")
+			continue
+		}
+		payments = append(payments, utxo.Payment{To: to, Amount: amount})
+	}
+}
@@ -1,9 +1,17 @@
 package accountbook
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
 	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/miner"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
 )
 
@@ -11,15 +19,23 @@ import (
 type AccountBook struct {
 	Chain   *blockchain.Blockchain
 	UTXOSet *utxo.UTXOSet
+	Pool    *blockchain.TxPool // 等待后台矿工打包的交易
+	Miner   *miner.Miner       // 后台矿工，未启动时为nil
+}
+
+// 初始化账本（区块链+UTXO集），network缺省为主网络
+func NewAccountBook(dbPath string, network ...*blockchain.Network) *AccountBook {
+	return NewAccountBookWithChain(blockchain.NewBlockchain(dbPath, network...))
 }
 
-// 初始化账本（区块链+UTXO集）
-func NewAccountBook(dbPath string) *AccountBook {
-	chain := blockchain.NewBlockchain(dbPath)
-	utxoSet := &utxo.UTXOSet{Blockchain: chain}
+// 在已打开的区块链上初始化账本，如使用内存存储的链
+func NewAccountBookWithChain(chain *blockchain.Blockchain) *AccountBook {
+	pool := &blockchain.TxPool{}
+	utxoSet := &utxo.UTXOSet{Blockchain: chain, Pool: pool}
 	return &AccountBook{
 		Chain:   chain,
 		UTXOSet: utxoSet,
+		Pool:    pool,
 	}
 }
 
@@ -34,28 +50,191 @@ func (ab *AccountBook) GetAddress(w *wallet.Wallet) string {
 }
 
 // 查询余额
-func (ab *AccountBook) GetBalance(address string) int {
+func (ab *AccountBook) GetBalance(address string) tx.Amount {
 	pubKeyHash := wallet.GetPubKeyHashFromAddress(address)
 	utxos := ab.UTXOSet.FindUTXO(pubKeyHash)
-	balance := 0
+	var balance tx.Amount
 	for _, out := range utxos {
 		balance += out.Value
 	}
 	return balance
 }
 
+// 查询余额明细：已确认、待确认与未成熟
+func (ab *AccountBook) GetBalances(address string) utxo.Balance {
+	return ab.UTXOSet.GetBalance(wallet.GetPubKeyHashFromAddress(address))
+}
+
+// 查询某地址在交易池中的待确认交易
+func (ab *AccountBook) PendingTransactions(address string) []*tx.Transaction {
+	return ab.UTXOSet.PendingTransactions(wallet.GetPubKeyHashFromAddress(address))
+}
+
 // 创建交易（from向to转账amount）
-func (ab *AccountBook) CreateTransaction(from, to string, amount int, w *wallet.Wallet) (*tx.Transaction, error) {
-	return ab.UTXOSet.CreateTransaction(from, to, amount, w)
+func (ab *AccountBook) CreateTransaction(from, to string, amount tx.Amount, w *wallet.Wallet, opts ...utxo.TxOption) (*tx.Transaction, error) {
+	return ab.UTXOSet.CreateTransaction(from, to, amount, w, opts...)
+}
+
+// 创建批量付款交易（from向多个收款方转账，只生成一笔交易）
+func (ab *AccountBook) CreateBatchTransaction(from string, payments []utxo.Payment, w *wallet.Wallet, opts ...utxo.TxOption) (*tx.Transaction, error) {
+	return ab.UTXOSet.CreateBatchTransaction(from, payments, w, opts...)
+}
+
+// 创建由多个钱包共同出资的交易，找零转入changeAddress
+func (ab *AccountBook) CreateMultiWalletTransaction(wallets []*wallet.Wallet, payments []utxo.Payment, changeAddress string, opts ...utxo.TxOption) (*tx.Transaction, error) {
+	return ab.UTXOSet.CreateMultiWalletTransaction(wallets, payments, changeAddress, opts...)
+}
+
+// 合并某地址的零散UTXO
+func (ab *AccountBook) Consolidate(address string, w *wallet.Wallet, maxInputs int, opts ...utxo.TxOption) (*tx.Transaction, error) {
+	return ab.UTXOSet.Consolidate(address, w, maxInputs, opts...)
 }
 
 // 打包并添加区块（自动添加Coinbase奖励给minerAddress）
-func (ab *AccountBook) AddBlock(txs []*tx.Transaction, minerAddress string) {
+// 区块写入失败时返回错误，未上链的交易留在账本的交易池中
+// 不合法的交易被丢弃，不放回交易池，通过*blockchain.RejectedError报告
+func (ab *AccountBook) AddBlock(txs []*tx.Transaction, minerAddress string) error {
 	pool := blockchain.TxPool{}
 	for _, t := range txs {
 		pool.AddTx(t)
 	}
-	ab.Chain.AddBlock(&pool, minerAddress)
+	if !ab.MinerRunning() {
+		// 没有后台矿工时，交易池中已到期的交易一并打包
+		for _, t := range ab.Pool.PopTx() {
+			pool.AddTx(t)
+		}
+	}
+	err := ab.Chain.AddBlock(&pool, minerAddress)
+	// 尚未生效的交易转入账本的交易池，到期后再打包
+	for _, t := range pool.PopTx() {
+		ab.Pool.AddTx(t)
+	}
+	return err
+}
+
+// 提交交易到交易池，等待后台矿工打包
+// 交易需通过交易池的准入检查（签名、余额、标准交易规则与最低转发费）
+func (ab *AccountBook) SubmitTx(t *tx.Transaction) error {
+	return ab.Pool.AcceptTx(ab.Chain, t)
+}
+
+// 提高交易池中某笔可替换交易的手续费：从找零中扣除，构造替换交易并提交
+// 新手续费满足替换规则的最低要求，且不低于按feeRate（每1000字节）计算的值
+func (ab *AccountBook) BumpFee(txid []byte, w *wallet.Wallet, feeRate tx.Amount) (*tx.Transaction, error) {
+	return ab.replaceTx(txid, feeRate, func(orig *tx.Transaction, fee tx.Amount) (*tx.Transaction, error) {
+		return ab.UTXOSet.BumpFee(orig, fee, w)
+	})
+}
+
+// 取消交易池中某笔可替换交易：以更高手续费将其输入全部退回钱包
+func (ab *AccountBook) CancelTx(txid []byte, w *wallet.Wallet) (*tx.Transaction, error) {
+	return ab.replaceTx(txid, 0, func(orig *tx.Transaction, fee tx.Amount) (*tx.Transaction, error) {
+		return ab.UTXOSet.CancelTransaction(orig, fee, w)
+	})
+}
+
+// 构造并提交替换交易，手续费不足时按新交易大小提高后重新构造
+func (ab *AccountBook) replaceTx(txid []byte, feeRate tx.Amount, build func(*tx.Transaction, tx.Amount) (*tx.Transaction, error)) (*tx.Transaction, error) {
+	orig := ab.Pool.GetTx(txid)
+	if orig == nil {
+		return nil, errors.New("交易不在交易池中")
+	}
+	if !orig.SignalsReplacement() {
+		return nil, errors.New("交易未声明可替换")
+	}
+	policy := ab.Pool.GetPolicy()
+	// 原交易的后代会随之被移出交易池，其手续费也须由替换交易补足
+	oldFee := ab.Pool.TxFee(ab.Chain, orig)
+	for _, d := range ab.Pool.Descendants(txid) {
+		oldFee += ab.Pool.TxFee(ab.Chain, d)
+	}
+	fee := oldFee
+	for {
+		t, err := build(orig, fee)
+		if err != nil {
+			return nil, err
+		}
+		required := max(policy.ReplacementFee(oldFee, t.Size()), tx.FeeForSize(feeRate, t.Size()))
+		if fee < required {
+			fee = required
+			continue
+		}
+		if err := ab.SubmitTx(t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+}
+
+// 获取区块模板，供外部矿工使用
+func (ab *AccountBook) GetBlockTemplate(maxTxs int) *blockchain.BlockTemplate {
+	return ab.Chain.GetBlockTemplate(ab.Pool, maxTxs)
+}
+
+// 提交外部挖出的区块，校验通过后上链，并从交易池移除已打包的交易
+func (ab *AccountBook) SubmitBlock(block *pow.Block) error {
+	if err := ab.Chain.SubmitBlock(block); err != nil {
+		return err
+	}
+	ab.Pool.RemoveTx(block.Transactions)
+	return nil
+}
+
+// 断开链尾区块，其中的普通交易不受最低转发费限制，重新放回交易池
+// 原交易池中的交易随后按原顺序放回：花费了已不存在的输出（如被断开区块的Coinbase）、
+// 尚未成熟的Coinbase，或与区块中的交易冲突的交易及其后代不再留在交易池中，作为dropped返回
+func (ab *AccountBook) DisconnectTip() (block *pow.Block, dropped []*tx.Transaction, err error) {
+	block, err = ab.Chain.DisconnectTip()
+	if err != nil {
+		return nil, nil, err
+	}
+	pending := ab.Pool.PopTx()
+	for _, t := range slices.Concat(block.Transactions[1:], pending) {
+		if err := ab.Pool.RestoreTx(ab.Chain, t); err != nil {
+			dropped = append(dropped, t)
+		}
+	}
+	return block, dropped, nil
+}
+
+// 在后台用区块文件验证快照之前的历史，验证结束后从返回的通道得到结果
+func (ab *AccountBook) VerifyHistoryInBackground(chainFile string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		f, err := os.Open(chainFile)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer f.Close()
+		done <- ab.Chain.VerifyHistory(f)
+	}()
+	return done
+}
+
+// 启动后台矿工，奖励发往minerAddress
+func (ab *AccountBook) StartMiner(minerAddress string) error {
+	if ab.MinerRunning() {
+		return errors.New("矿工已在运行")
+	}
+	m := miner.New(ab.Chain, ab.Pool, miner.Config{Address: minerAddress})
+	if err := m.Start(); err != nil {
+		return err
+	}
+	ab.Miner = m
+	return nil
+}
+
+// 停止后台矿工
+func (ab *AccountBook) StopMiner() {
+	if ab.Miner != nil {
+		ab.Miner.Stop()
+	}
+}
+
+// 后台矿工是否在运行
+func (ab *AccountBook) MinerRunning() bool {
+	return ab.Miner != nil && ab.Miner.Status().Running
 }
 
 // 查询某地址所有UTXO
@@ -74,8 +253,24 @@ func (ab *AccountBook) FindTransaction(txid []byte) *tx.Transaction {
 	return ab.Chain.FindTx(txid)
 }
 
-// 创建Coinbase交易
+// 为交易记录备注，见Blockchain.SetMemo
+func (ab *AccountBook) SetMemo(txid []byte, memo string) error {
+	return ab.Chain.SetMemo(txid, memo)
+}
+
+// 交易的备注
+func (ab *AccountBook) GetMemo(txid []byte) string {
+	return ab.Chain.GetMemo(txid)
+}
+
+// 创建Coinbase交易，data为空时写入下一个区块的高度与随机数，避免多次发往同一地址的奖励交易ID相同
+// （出块前向同一地址创建多笔奖励时高度相同，只靠高度无法区分）
 func (ab *AccountBook) NewCoinbaseTx(to, data string) *tx.Transaction {
+	if data == "" {
+		nonce := make([]byte, 8)
+		rand.Read(nonce)
+		data = fmt.Sprintf("Height %d reward to '%s' #%x", len(ab.Chain.GetBlocks()), to, nonce)
+	}
 	return tx.NewCoinbaseTX(to, data)
 }
 
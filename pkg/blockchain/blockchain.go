@@ -2,144 +2,605 @@ package blockchain
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
-	"github.com/marshuni/Blockchain-AccountBook/pkg/db" // 新增
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
 )
 
 // 区块链
 type Blockchain struct {
-	Blocks []*pow.Block
-	db     *db.DB // 新增
+	Blocks []*pow.Block // 高度低于PruneHeight()的区块只含区块头
+	Net    *Network     // 所属网络
+	Prune  *PruneConfig // 裁剪设置，为nil时不裁剪
+	store  db.Store     // 区块存储
+	utxos  utxoView     // 链尾处的未花费输出，与数据库中的utxo索引一致
+	pruned int          // 高度低于该值的区块已被裁剪
+	mu     sync.RWMutex
 }
 
 // 交易池
 type TxPool struct {
 	Transactions []*tx.Transaction
+	Policy       *Policy // 准入策略，为nil时使用DefaultPolicy
+	mu           sync.Mutex
+	version      uint64 // 每次内容变化时递增，便于矿工判断是否需要重建区块
 }
 
-// 初始化区块链，含创建创世块
-func NewBlockchain(dbPath string) *Blockchain {
-	database, err := db.OpenDB(dbPath)
+// 初始化区块链，使用dbPath处的bolt数据库，含创建创世块
+// network 缺省为MainNet；数据库中已有的创世块与该网络不符时拒绝打开
+func NewBlockchain(dbPath string, network ...*Network) *Blockchain {
+	net := MainNet
+	if len(network) > 0 {
+		net = network[0]
+	}
+	// 升级旧版本数据库之前先确认属于该网络，不修改随后会被拒绝的数据库
+	store, err := db.Open(dbPath, func(s db.Store) error { return checkStore(s, net) })
+	if err != nil {
+		panic(fmt.Errorf("数据库 %s: %w", dbPath, err))
+	}
+	bc, err := NewBlockchainWithStore(store, network...)
 	if err != nil {
-		panic(err)
+		store.Close()
+		panic(fmt.Errorf("数据库 %s: %w", dbPath, err))
+	}
+	return bc
+}
+
+// 在给定存储上初始化区块链，存储为空时写入创世块
+// 如 NewBlockchainWithStore(db.NewMemStore(), TestNet) 得到不落盘的链
+func NewBlockchainWithStore(store db.Store, network ...*Network) (*Blockchain, error) {
+	net := MainNet
+	if len(network) > 0 {
+		net = network[0]
 	}
 	bc := &Blockchain{
 		Blocks: []*pow.Block{},
-		db:     database,
+		Net:    net,
+		store:  store,
+	}
+	recorded, err := bc.checkNetwork()
+	if err != nil {
+		return nil, err
 	}
 	// 尝试从数据库加载区块
-	lastHash, err := database.GetLastHash()
-	if err != nil && err.Error() != "last hash not found" {
-		panic(err)
-	}
-	if lastHash != nil {
-		// 从数据库加载所有区块
-		hash := lastHash
-		for hash != nil {
-			var block pow.Block
-			err := database.GetBlock(hash, &block)
-			if err != nil {
-				break
+	lastHash, err := store.GetTip()
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		// 数据库为空，写入该网络固定的创世块
+		bc.utxos = make(utxoView)
+		if err := bc.appendBlock(net.GenesisBlock()); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if bc.Blocks, err = readBlocks(store, lastHash, net); err != nil {
+			return nil, err
+		}
+		if err := bc.loadPruneHeight(); err != nil {
+			return nil, err
+		}
+		if err := bc.loadPruneConfig(); err != nil {
+			return nil, err
+		}
+		if err := bc.loadChainState(); err != nil {
+			return nil, err
+		}
+	}
+	if !recorded {
+		// 新建或旧版本的数据库，创世块确认无误后记录所属网络
+		batch := db.NewBatch()
+		batch.PutMeta(db.NetworkKey, binary.BigEndian.AppendUint32(nil, net.ID))
+		if err := store.Write(batch); err != nil {
+			return nil, err
+		}
+	}
+	return bc, nil
+}
+
+// 关闭区块链所用的存储
+func (bc *Blockchain) Close() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.store.Close()
+}
+
+// 把存储备份为bolt数据库文件，备份期间可以照常接入新区块
+func (bc *Blockchain) Backup(w io.Writer) (int64, error) {
+	return bc.store.Backup(w)
+}
+
+// 打包交易池中的所有交易，挖掘新的区块并添加到链上
+// 每个区块的第一笔交易都是Coinbase：交易池中的Coinbase金额已定，各自单独成块，以免同块交易的手续费无人领取；
+// 其余交易打包进新建Coinbase的区块，Coinbase领取挖矿奖励与该区块的手续费、发往minerAddress；
+// minerAddress为空时只把手续费发往无人能花费的全零公钥哈希，不产生新币
+// 交易超出单个区块的大小或签名检查次数限制时，依次打包进多个区块，每个区块按其实际高度检查交易
+// 尚未生效或花费未成熟Coinbase的交易留在交易池中；不合法的交易被丢弃，在返回的*RejectedError中列出，
+// 此时其余交易仍正常出块
+// 区块写入失败时返回错误，尚未上链的交易放回交易池
+func (bc *Blockchain) AddBlock(p *TxPool, minerAddress string) error {
+	var rejected []RejectedTx
+	for {
+		// 挖矿期间链尾被后台矿工更新时，交易已放回交易池，基于新链尾重新选取
+		err := bc.addBlocks(p, minerAddress, &rejected)
+		if err == ErrStaleTip {
+			continue
+		}
+		if len(rejected) > 0 {
+			err = errors.Join(err, &RejectedError{Rejected: rejected})
+		}
+		return err
+	}
+}
+
+// 本地出块时被丢弃的交易及原因
+type RejectedTx struct {
+	Tx  *tx.Transaction
+	Err error
+}
+
+// AddBlock丢弃了不合法的交易，其余交易已正常出块
+type RejectedError struct {
+	Rejected []RejectedTx
+}
+
+func (e *RejectedError) Error() string {
+	msgs := make([]string, len(e.Rejected))
+	for i, r := range e.Rejected {
+		msgs[i] = fmt.Sprintf("交易 %x: %v", r.Tx.ID, r.Err)
+	}
+	return fmt.Sprintf("%d笔交易不合法，已丢弃: %s", len(e.Rejected), strings.Join(msgs, "; "))
+}
+
+func (bc *Blockchain) addBlocks(p *TxPool, minerAddress string, rejected *[]RejectedTx) error {
+	var coinbases, pending []*tx.Transaction
+	for _, t := range p.PopTx() {
+		if err := t.CheckSanity(); err != nil {
+			*rejected = append(*rejected, RejectedTx{t, err})
+		} else if t.IsCoinbase() {
+			coinbases = append(coinbases, t)
+		} else {
+			pending = append(pending, t)
+		}
+	}
+
+	for i, coinbase := range coinbases {
+		if err := bc.checkPoolCoinbase(coinbase); err != nil {
+			*rejected = append(*rejected, RejectedTx{coinbase, err})
+			continue
+		}
+		if err := bc.mineAndConnect([]*tx.Transaction{coinbase}); err != nil {
+			for _, t := range slices.Concat(coinbases[i:], pending) {
+				p.AddTx(t)
 			}
-			bc.Blocks = append([]*pow.Block{&block}, bc.Blocks...)
-			hash = block.PreviousHash[:]
-			if bytes.Equal(hash, make([]byte, 32)) {
-				break
+			return err
+		}
+	}
+
+	for len(pending) > 0 {
+		height, blockTxs, fees, rest := bc.nextBlockTxs(pending, minerAddress, rejected)
+		if len(blockTxs) == 0 {
+			break
+		}
+		coinbase := blockCoinbase(minerAddress, height, fees)
+		if err := bc.mineAndConnect(append([]*tx.Transaction{coinbase}, blockTxs...)); err != nil {
+			for _, t := range slices.Concat(blockTxs, rest) {
+				p.AddTx(t)
 			}
+			return err
 		}
-	} else {
-		// 数据库为空，创建创世块
-		genesisBlock := &pow.Block{
-			Version:      2,
-			PreviousHash: [32]byte{},
-			MerkleRoot:   [32]byte{},
-			Timestamp:    uint32(time.Now().Unix()),
-			Bits:         [4]byte{0x1f, 0x00, 0xff, 0xff},
-			Nounce:       0,
-		}
-		bc.Blocks = []*pow.Block{genesisBlock}
-		// 存储创世块
-		hash := genesisBlock.CalculateHash()
-		_ = database.PutBlock(hash[:], genesisBlock)
-		_ = database.UpdateLastHash(hash[:])
+		pending = rest
 	}
-	return bc
+	// 尚未生效或花费未成熟Coinbase的交易，以及花费它们输出的交易，放回交易池
+	for _, t := range pending {
+		p.AddTx(t)
+	}
+	return nil
 }
 
-// 打包交易池中的所有区块，挖掘新的区块并添加到链上（自行添加一个Coinbase）
-func (bc *Blockchain) AddBlock(p *TxPool, minerAddress string) {
-	// 获取交易池中的所有交易
-	transactions := p.PopTx()
-	if transactions == nil {
-		return // 如果没有交易，则不创建新的区块
+// 交易池中的Coinbase单独成块前的检查：交易ID与内容相符、金额不超过挖矿奖励、与链上的交易不重复
+func (bc *Blockchain) checkPoolCoinbase(t *tx.Transaction) error {
+	if !bytes.Equal(t.CalcID(), t.ID) {
+		return errors.New("Coinbase交易ID与内容不符")
+	}
+	var value tx.Amount
+	for _, out := range t.Outputs {
+		value += out.Value
+	}
+	if value > tx.BlockSubsidy {
+		return fmt.Errorf("Coinbase金额%s超过挖矿奖励%s", value, tx.BlockSubsidy)
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.checkDuplicateTx(t)
+}
+
+// 为接在当前链尾的下一个区块依次选取交易，返回区块高度、所选交易、手续费之和与剩余交易
+// 时间锁按该区块之前的中位时间、成熟度按该区块的高度检查，在区块大小与签名检查次数限制内尽量多放
+// 尚未生效的交易、花费它们输出的交易以及放不下的交易留在rest中；不合法的交易记入rejected
+func (bc *Blockchain) nextBlockTxs(pending []*tx.Transaction, minerAddress string, rejected *[]RejectedTx) (height int, blockTxs []*tx.Transaction, fees tx.Amount, rest []*tx.Transaction) {
+	bc.mu.RLock()
+	height, view, mtp := len(bc.Blocks), bc.utxoView(), bc.medianTimePast()
+	bc.mu.RUnlock()
+	now := uint32(time.Now().Unix())
+
+	// 金额不影响Coinbase的大小，按不含手续费的Coinbase计算区块大小
+	base := (&pow.Block{Transactions: []*tx.Transaction{blockCoinbase(minerAddress, height, 0)}}).Size()
+	size, sigOps, full := base, 0, false
+	waiting := make(map[string]bool)
+	for _, t := range pending {
+		if base+t.Size() > MaxBlockSize || t.SigOps() > MaxBlockSigOps {
+			*rejected = append(*rejected, RejectedTx{t, errors.New("交易超出单个区块的大小或签名检查次数限制")})
+			continue
+		}
+		if full || slices.ContainsFunc(t.Inputs, func(vin tx.TXInput) bool { return waiting[string(vin.Txid)] }) ||
+			view.checkLocks(t, height, mtp) != nil || view.checkMaturity(t, height, bc.Net.CoinbaseMaturity) != nil {
+			waiting[string(t.ID)] = true
+			rest = append(rest, t)
+			continue
+		}
+		fee, err := view.checkTx(t)
+		if err != nil {
+			*rejected = append(*rejected, RejectedTx{t, err})
+			continue
+		}
+		if size+t.Size() > MaxBlockSize || sigOps+t.SigOps() > MaxBlockSigOps {
+			full = true
+			waiting[string(t.ID)] = true
+			rest = append(rest, t)
+			continue
+		}
+		size += t.Size()
+		sigOps += t.SigOps()
+		view.connect([]*tx.Transaction{t}, height, now)
+		blockTxs = append(blockTxs, t)
+		fees += fee
 	}
+	return height, blockTxs, fees, rest
+}
+
+// 本地出块时新建的Coinbase，写入区块高度使交易ID不重复
+// minerAddress为空时只领取手续费，发往全零公钥哈希
+func blockCoinbase(minerAddress string, height int, fees tx.Amount) *tx.Transaction {
 	if minerAddress != "" {
-		// 添加Coinbase块
-		coinbaseTx := tx.NewCoinbaseTX(minerAddress, "")
-		transactions = append([]*tx.Transaction{coinbaseTx}, transactions...)
+		data := fmt.Sprintf("Height %d reward to '%s'", height, minerAddress)
+		return tx.NewCoinbaseTXWithValue(minerAddress, data, tx.BlockSubsidy+fees)
+	}
+	coinbase := &tx.Transaction{
+		Version: tx.TxVersion,
+		Inputs:  []tx.TXInput{{Txid: []byte{}, Vout: -1, Signature: []byte{}, PubKey: []byte(fmt.Sprintf("Height %d fees", height)), Sequence: tx.SequenceFinal}},
+		Outputs: []tx.TXOutput{{Value: fees, PubKeyHash: make([]byte, 20)}},
 	}
+	coinbase.ID = coinbase.CalcID()
+	return coinbase
+}
 
+// 挖掘包含给定交易的区块并接到链尾
+// 挖矿期间链尾被更新时返回ErrStaleTip，交易须基于新链尾重新检查后再打包
+func (bc *Blockchain) mineAndConnect(transactions []*tx.Transaction) error {
 	// 获取前一个区块的哈希值
-	var previousHash [32]byte
-	if len(bc.Blocks) > 0 {
-		previousHash = bc.Blocks[len(bc.Blocks)-1].CalculateHash()
-	}
+	previousHash := bc.TipHash()
 
 	// 使用pow.NewBlock()方法创建新的区块
 	// TODO: 难度值调节
-	newBlock := pow.NewBlock(previousHash, transactions)
+	newBlock := pow.NewBlock(previousHash, transactions, bc.Net.Bits)
+	if v := bc.Net.BlockVersion(); newBlock.Version != v {
+		newBlock.SetVersion(v)
+	}
+	// 之前的区块时间戳超前时，时间戳至少要大于它们的中位时间
+	newBlock.Timestamp = max(newBlock.Timestamp, bc.MedianTimePast()+1)
 
 	// 挖掘区块（工作量证明）
 	newBlock.MineBlock()
 
 	// 将新挖掘的区块添加到区块链
-	bc.Blocks = append(bc.Blocks, &newBlock)
-	// 存储到数据库
-	hash := newBlock.CalculateHash()
-	_ = bc.db.PutBlock(hash[:], &newBlock)
-	_ = bc.db.UpdateLastHash(hash[:])
+	return bc.ConnectBlock(&newBlock)
+}
+
+// 区块的前一区块不是当前链尾
+var ErrStaleTip = errors.New("区块的前一区块哈希与链尾不符")
+
+// 将本地挖出的区块接到链尾并存储，与SubmitBlock提交的区块一样经过完整校验
+func (bc *Blockchain) ConnectBlock(block *pow.Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.validateBlock(block); err != nil {
+		return err
+	}
+	return bc.appendBlock(block)
+}
+
+// 将区块存储到数据库并加入内存，调用方需持有写锁
+// 区块、链尾、未花费输出的变化、交易索引以及启用裁剪时对旧区块的裁剪在同一批次中原子地写入
+// 写入失败时内存状态不变
+func (bc *Blockchain) appendBlock(block *pow.Block) error {
+	view := maps.Clone(bc.utxos)
+	batch := connectBatch(view, block, len(bc.Blocks))
+	blocks, pruned := append(bc.Blocks, block), bc.pruned
+	if bc.Prune != nil {
+		pruned = max(pruned, bc.Prune.keepFrom(blocks))
+		blocks = bc.pruneBatch(batch, blocks, pruned)
+	}
+	if err := bc.store.Write(batch); err != nil {
+		return fmt.Errorf("写入区块失败: %w", err)
+	}
+	bc.Blocks, bc.pruned = blocks, pruned
+	bc.utxos = view
+	return nil
+}
+
+// 链尾区块的哈希
+func (bc *Blockchain) TipHash() [32]byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.tipHash()
+}
+
+func (bc *Blockchain) tipHash() [32]byte {
+	if len(bc.Blocks) == 0 {
+		return [32]byte{}
+	}
+	return bc.Blocks[len(bc.Blocks)-1].CalculateHash()
+}
+
+// 返回当前所有区块，供遍历使用
+// 返回的切片不受之后追加或断开区块的影响
+func (bc *Blockchain) GetBlocks() []*pow.Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.Blocks[:len(bc.Blocks):len(bc.Blocks)]
 }
 
-// 寻找特定ID的交易
+// 寻找特定ID的交易：按交易索引找到所在区块，已被裁剪的区块中的交易查不到
 func (bc *Blockchain) FindTx(TxID []byte) *tx.Transaction {
-	for _, block := range bc.Blocks {
-		for _, t := range block.Transactions {
-			if bytes.Equal(t.ID, TxID) {
-				return t
-			}
+	hash, err := bc.store.GetIndex(txIndex, TxID)
+	if err != nil {
+		return nil
+	}
+	block, err := bc.store.GetBlock(hash)
+	if err != nil {
+		return nil
+	}
+	for _, t := range block.Transactions {
+		if bytes.Equal(t.ID, TxID) {
+			return t
 		}
 	}
 	return nil
 }
 
+// 为交易记录备注，备注只保存在本地数据库中，不影响交易ID；memo为空时删除备注
+func (bc *Blockchain) SetMemo(txid []byte, memo string) error {
+	batch := db.NewBatch()
+	if memo == "" {
+		batch.DeleteIndex(memoIndex, txid)
+	} else {
+		batch.PutIndex(memoIndex, txid, []byte(memo))
+	}
+	return bc.store.Write(batch)
+}
+
+// 交易的备注，没有备注时返回空字符串
+func (bc *Blockchain) GetMemo(txid []byte) string {
+	memo, err := bc.store.GetIndex(memoIndex, txid)
+	if err != nil {
+		return ""
+	}
+	return string(memo)
+}
+
 // 添加新的交易到交易池
 func (p *TxPool) AddTx(t *tx.Transaction) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for _, tx := range p.Transactions {
 		if bytes.Equal(tx.ID, t.ID) {
 			return false
 		}
 	}
 	p.Transactions = append(p.Transactions, t)
+	p.version++
 	return true
 }
 
+// 交易池中所有交易的快照，父交易在前
+func (p *TxPool) GetTransactions() []*tx.Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.Transactions)
+}
+
+// 判断交易是否在交易池中
+func (p *TxPool) HasTx(id []byte) bool {
+	return p.GetTx(id) != nil
+}
+
+// 按ID查找交易池中的交易，不存在时返回nil
+func (p *TxPool) GetTx(id []byte) *tx.Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.Transactions {
+		if bytes.Equal(t.ID, id) {
+			return t
+		}
+	}
+	return nil
+}
+
 // 返回交易池的所有交易，清空交易池并返回
 func (p *TxPool) PopTx() []*tx.Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if len(p.Transactions) == 0 {
 		return nil
 	}
 	result := p.Transactions
 	p.Transactions = []*tx.Transaction{}
+	p.version++
 	return result
 }
 
+// 按祖先包费率从高到低挑选最多max笔交易（不移出交易池），max<=0时不限数量
+// 选中一笔交易时先选入其尚未选中的祖先，保证父交易排在子交易之前
+// 花费同一输出的交易只选先到的一笔
+func (p *TxPool) SelectTx(bc *Blockchain, max int) []*tx.Transaction {
+	view := p.poolView(bc)
+	p.mu.Lock()
+	g := newTxGraph(slices.Clone(p.Transactions))
+	p.mu.Unlock()
+
+	var selected []*tx.Transaction
+	chosen := make(map[string]bool)
+	skipped := make(map[string]bool)
+	spent := make(map[string]bool)
+	for max <= 0 || len(selected) < max {
+		// 找出包费率最高的交易
+		best, bestFee, bestSize := "", tx.Amount(0), 0
+		for _, t := range g.txs {
+			id := string(t.ID)
+			if chosen[id] || skipped[id] {
+				continue
+			}
+			fee, size := g.packageFee(id, view, chosen)
+			if best == "" || fee*tx.Amount(bestSize) > bestFee*tx.Amount(size) {
+				best, bestFee, bestSize = id, fee, size
+			}
+		}
+		if best == "" {
+			break
+		}
+
+		var pkg []*tx.Transaction
+		for _, id := range append(g.ancestors(best), best) {
+			if !chosen[id] {
+				pkg = append(pkg, g.tx(id))
+			}
+		}
+		if (max > 0 && len(selected)+len(pkg) > max) || slices.ContainsFunc(pkg, func(t *tx.Transaction) bool { return conflicts(t, spent) }) {
+			skipped[best] = true
+			continue
+		}
+		for _, t := range pkg {
+			chosen[string(t.ID)] = true
+			for _, vin := range t.Inputs {
+				spent[outpointKey(vin.Txid, vin.Vout)] = true
+			}
+		}
+		selected = append(selected, pkg...)
+	}
+	return selected
+}
+
+// 移除已上链的交易，以及与其花费相同输出的冲突交易和这些冲突交易的后代
+func (p *TxPool) RemoveTx(txs []*tx.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(txs)
+}
+
+// 同RemoveTx，调用方需持有锁
+func (p *TxPool) removeLocked(txs []*tx.Transaction) {
+	ids := make(map[string]bool)
+	spent := make(map[string]bool)
+	for _, t := range txs {
+		ids[string(t.ID)] = true
+		if t.IsCoinbase() {
+			continue
+		}
+		for _, vin := range t.Inputs {
+			spent[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+
+	// 因冲突移除的交易，其后代也随之失效；交易池中父交易总在子交易之前，一次遍历即可
+	invalid := make(map[string]bool)
+	var remaining []*tx.Transaction
+	for _, t := range p.Transactions {
+		if ids[string(t.ID)] {
+			continue
+		}
+		if conflicts(t, spent) || slices.ContainsFunc(t.Inputs, func(vin tx.TXInput) bool { return invalid[string(vin.Txid)] }) {
+			invalid[string(t.ID)] = true
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	if len(remaining) != len(p.Transactions) {
+		p.Transactions = remaining
+		p.version++
+	}
+}
+
+// 按当前链状态重新检查交易池中的交易，移除不再合法的交易并返回
+// 父交易总在子交易之前，父交易被移除后子交易的输入不存在，随之被移除
+func (p *TxPool) RemoveInvalid(bc *Blockchain) []*tx.Transaction {
+	bc.mu.RLock()
+	view, height := bc.utxoView(), len(bc.Blocks)
+	bc.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var removed, remaining []*tx.Transaction
+	for _, t := range p.Transactions {
+		if _, err := view.checkTx(t); err != nil {
+			removed = append(removed, t)
+			continue
+		}
+		view.addUnconfirmed([]*tx.Transaction{t}, height)
+		remaining = append(remaining, t)
+	}
+	if len(removed) > 0 {
+		p.Transactions = remaining
+		p.version++
+	}
+	return removed
+}
+
+// 交易池中的交易数量
+func (p *TxPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.Transactions)
+}
+
+// 交易池内容版本，内容每变化一次加一
+func (p *TxPool) Version() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version
+}
+
+// 判断交易是否花费了spent中已记录的输出
+func conflicts(t *tx.Transaction, spent map[string]bool) bool {
+	if t.IsCoinbase() {
+		return false
+	}
+	for _, vin := range t.Inputs {
+		if spent[outpointKey(vin.Txid, vin.Vout)] {
+			return true
+		}
+	}
+	return false
+}
+
+// 输出点（交易ID+输出索引）的字符串键，见outpointBytes
+func outpointKey(txid []byte, vout int) string {
+	return string(outpointBytes(txid, vout))
+}
+
 // 打印区块链所有区块及其交易信息
 func (bc *Blockchain) Print() {
-	for i, block := range bc.Blocks {
+	for i, block := range bc.GetBlocks() {
 		fmt.Printf("Block #%d:\n", i)
 		fmt.Printf("  Version: %d\n", block.Version)
 		fmt.Printf("  PreviousHash: %x\n", block.PreviousHash)
@@ -162,7 +623,7 @@ func (bc *Blockchain) Print() {
 			fmt.Printf("      Vout:\n")
 			for k, vout := range tx.Outputs {
 				fmt.Printf("        Vout #%d:\n", k)
-				fmt.Printf("          Value: %d\n", vout.Value)
+				fmt.Printf("          Value: %s\n", vout.Value)
 				fmt.Printf("          ScriptPubKeyHash: %x\n", vout.PubKeyHash)
 			}
 		}
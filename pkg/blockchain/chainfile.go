@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+)
+
+// 区块文件格式：
+//
+//	魔数"ABKC" 版本(4) 网络ID(4) 区块数(4)
+//	每个区块：长度(4) + pow.Block.Serialize的结果，从创世块开始依次排列
+//	校验和：之前所有字节的SHA-256(32)
+//
+// 数值均为大端序
+var chainFileMagic = [4]byte{'A', 'B', 'K', 'C'}
+
+const chainFileVersion = 1
+
+// 单个区块在文件中的长度上限，防止损坏的长度字段导致过量分配
+const maxFileBlockSize = 4 * MaxBlockSize
+
+// 导出整条链到区块文件，旧区块已被裁剪时无法导出
+func (bc *Blockchain) ExportChain(w io.Writer) error {
+	bc.mu.RLock()
+	blocks, pruned := bc.Blocks[:len(bc.Blocks):len(bc.Blocks)], bc.pruned
+	bc.mu.RUnlock()
+	if pruned > 0 {
+		return fmt.Errorf("区块 #0-#%d: %w", pruned-1, ErrPruned)
+	}
+
+	bw := bufio.NewWriter(w)
+	fw := &hashWriter{w: bw, h: sha256.New()}
+	head := binary.BigEndian.AppendUint32(chainFileMagic[:], chainFileVersion)
+	head = binary.BigEndian.AppendUint32(head, bc.Net.ID)
+	head = binary.BigEndian.AppendUint32(head, uint32(len(blocks)))
+	fw.Write(head)
+	for _, block := range blocks {
+		data := block.Serialize()
+		fw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+		fw.Write(data)
+	}
+	if fw.err != nil {
+		return fw.err
+	}
+	if _, err := bw.Write(fw.h.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// 读取区块文件，检查格式、网络与校验和，返回其中的全部区块
+// 只检查文件完整性，区块本身的合法性由导入时的完整校验保证
+func ReadChainFile(r io.Reader, net *Network) ([]*pow.Block, error) {
+	fr := &hashReader{r: bufio.NewReader(r), h: sha256.New()}
+	head := fr.next(16)
+	if fr.err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %w", fr.err)
+	}
+	if !bytes.Equal(head[:4], chainFileMagic[:]) {
+		return nil, errors.New("不是区块文件")
+	}
+	if v := binary.BigEndian.Uint32(head[4:]); v != chainFileVersion {
+		return nil, fmt.Errorf("不支持的区块文件版本%d", v)
+	}
+	if id := binary.BigEndian.Uint32(head[8:]); id != net.ID {
+		return nil, fmt.Errorf("区块文件属于网络%08x，与%s网络（%08x）不符", id, net.Name, net.ID)
+	}
+	count := binary.BigEndian.Uint32(head[12:])
+	var blocks []*pow.Block
+	for i := uint32(0); i < count; i++ {
+		size := binary.BigEndian.Uint32(fr.next(4))
+		if fr.err == nil && size > maxFileBlockSize {
+			return nil, fmt.Errorf("区块 #%d 长度%d超出上限", i, size)
+		}
+		data := fr.next(int(size))
+		if fr.err != nil {
+			return nil, fmt.Errorf("读取区块 #%d 失败: %w", i, fr.err)
+		}
+		block, err := pow.DeserializeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("区块 #%d: %w", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	sum := fr.h.Sum(nil)
+	var checksum [32]byte
+	if _, err := io.ReadFull(fr.r, checksum[:]); err != nil {
+		return nil, fmt.Errorf("读取校验和失败: %w", err)
+	}
+	if !bytes.Equal(sum, checksum[:]) {
+		return nil, errors.New("校验和不符，文件已损坏")
+	}
+	if len(blocks) == 0 || blocks[0].CalculateHash() != net.GenesisHash {
+		return nil, fmt.Errorf("区块文件的创世块与%s网络不符", net.Name)
+	}
+	return blocks, nil
+}
+
+// 从区块文件导入区块：已有的区块须与文件一致，之后的区块经完整校验后依次接到链尾
+// 返回新导入的区块数；中途校验失败时，之前导入的区块保留
+func (bc *Blockchain) ImportChain(r io.Reader) (int, error) {
+	blocks, err := ReadChainFile(r, bc.Net)
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for height, block := range blocks {
+		added, err := bc.importBlock(height, block)
+		if err != nil {
+			return imported, fmt.Errorf("区块 #%d: %w", height, err)
+		}
+		if added {
+			imported++
+		}
+	}
+	return imported, nil
+}
+
+// 导入单个区块，已在链上时跳过并返回false
+func (bc *Blockchain) importBlock(height int, block *pow.Block) (bool, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if height < len(bc.Blocks) {
+		if bc.Blocks[height].CalculateHash() != block.CalculateHash() {
+			return false, errors.New("与本地链分叉")
+		}
+		return false, nil
+	}
+	if err := bc.validateBlock(block); err != nil {
+		return false, err
+	}
+	return true, bc.appendBlock(block)
+}
+
+// 写入时同时计算哈希，记录第一个错误
+type hashWriter struct {
+	w   io.Writer
+	h   hash.Hash
+	err error
+}
+
+func (w *hashWriter) Write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	w.h.Write(p)
+	_, w.err = w.w.Write(p)
+}
+
+// 读取时同时计算哈希，记录第一个错误
+type hashReader struct {
+	r   io.Reader
+	h   hash.Hash
+	err error
+}
+
+func (r *hashReader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		r.err = err
+		return buf
+	}
+	r.h.Write(buf)
+	return buf
+}
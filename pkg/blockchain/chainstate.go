@@ -0,0 +1,270 @@
+package blockchain
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 数据库中的索引与元数据
+const (
+	utxoIndex   = "utxo"     // 输出位置 -> 未花费输出
+	txIndex     = "tx"       // 交易ID -> 所在区块哈希
+	undoIndex   = "undo"     // 区块哈希 -> 区块花费的输出，见blockUndo
+	memoIndex   = "memo"     // 交易ID -> 备注，只保存在本地，不属于区块内容
+	indexTipKey = "indexTip" // 索引对应的链尾区块哈希
+)
+
+// 输出位置的存储键：交易ID + 4字节大端序号
+func outpointBytes(txid []byte, vout int) []byte {
+	return binary.BigEndian.AppendUint32(bytes.Clone(txid), uint32(vout))
+}
+
+// 未花费输出的存储格式：金额(8) 高度(4) 时间(4) 是否Coinbase(1) 公钥哈希
+func encodeUTXOEntry(e utxoEntry) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(e.Value))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(e.Height))
+	buf = binary.BigEndian.AppendUint32(buf, e.Time)
+	if e.Coinbase {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	return append(buf, e.PubKeyHash...)
+}
+
+func decodeUTXOEntry(data []byte) (utxoEntry, error) {
+	if len(data) < 17 {
+		return utxoEntry{}, errors.New("未花费输出记录长度不足")
+	}
+	return utxoEntry{
+		TXOutput: tx.TXOutput{
+			Value:      tx.Amount(binary.BigEndian.Uint64(data)),
+			PubKeyHash: bytes.Clone(data[17:]),
+		},
+		Height:   int(binary.BigEndian.Uint32(data[8:])),
+		Time:     binary.BigEndian.Uint32(data[12:]),
+		Coinbase: data[16] == 1,
+	}, nil
+}
+
+// 将区块接到链尾所需的全部写入：区块、链尾、未花费输出的变化、撤销记录与交易索引
+// 同时把变化应用到view上
+func connectBatch(view utxoView, block *pow.Block, height int) *db.Batch {
+	hash := block.CalculateHash()
+	batch := db.NewBatch()
+	batch.PutBlock(hash[:], block)
+	batch.SetTip(hash[:])
+	undo := connectWithUndo(view, block, height)
+	for _, t := range block.Transactions {
+		if !t.IsCoinbase() {
+			for _, vin := range t.Inputs {
+				batch.DeleteIndex(utxoIndex, outpointBytes(vin.Txid, vin.Vout))
+			}
+		}
+		for idx := range t.Outputs {
+			// 同一区块内被花费的输出在上面已删除，这里不再写入
+			if e, ok := view[outpointKey(t.ID, idx)]; ok {
+				batch.PutIndex(utxoIndex, outpointBytes(t.ID, idx), encodeUTXOEntry(e))
+			}
+		}
+		batch.PutIndex(txIndex, t.ID, hash[:])
+	}
+	batch.PutIndex(undoIndex, hash[:], undo.encode())
+	batch.PutMeta(indexTipKey, hash[:])
+	return batch
+}
+
+// 检查数据库记录的网络ID与当前网络是否一致，返回数据库中是否已有记录
+func (bc *Blockchain) checkNetwork() (bool, error) {
+	data, err := bc.store.GetMeta(db.NetworkKey)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(data) != 4 {
+		return false, fmt.Errorf("数据库的网络记录无效: %x", data)
+	}
+	if id := binary.BigEndian.Uint32(data); id != bc.Net.ID {
+		return false, fmt.Errorf("数据库属于网络%08x，与%s网络（%08x）不符，拒绝打开", id, bc.Net.Name, bc.Net.ID)
+	}
+	return true, nil
+}
+
+// 以只读方式检查存储中的链属于该网络：网络记录与创世块均须相符
+func checkStore(store db.Store, net *Network) error {
+	bc := &Blockchain{Net: net, store: store}
+	if _, err := bc.checkNetwork(); err != nil {
+		return err
+	}
+	tip, err := store.GetTip()
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = readBlocks(store, tip, net)
+	return err
+}
+
+// 从链尾沿前一区块哈希读取所有区块，按高度排列，并确认创世块与网络相符
+func readBlocks(store db.Store, tip []byte, net *Network) ([]*pow.Block, error) {
+	var blocks []*pow.Block
+	hash := tip
+	for {
+		block, err := store.GetBlock(hash)
+		if err != nil {
+			return nil, fmt.Errorf("读取区块 %x 失败: %w", hash, err)
+		}
+		blocks = append(blocks, block)
+		if block.PreviousHash == [32]byte{} {
+			break
+		}
+		hash = block.PreviousHash[:]
+	}
+	slices.Reverse(blocks)
+	if hash := blocks[0].CalculateHash(); hash != net.GenesisHash {
+		return nil, genesisMismatch(store, hash, net)
+	}
+	return blocks, nil
+}
+
+// 数据库由固定创世块之前的程序创建：创世块随首次启动的时间生成，交易ID按旧编码计算，无法升级
+var ErrLegacyDatabase = errors.New("数据库由旧版本程序创建（创世块随启动时间生成，交易ID按旧编码计算），无法升级；请备份后删除该数据库重新创建，再重新导入账目")
+
+// 创世块与网络不符的原因：属于另一个已知网络，或是结构版本2之前、创世块不固定的旧数据库
+func genesisMismatch(store db.Store, hash [32]byte, net *Network) error {
+	for _, known := range []*Network{MainNet, TestNet} {
+		if hash == known.GenesisHash {
+			return fmt.Errorf("数据库属于%s网络，与%s网络不符，拒绝打开", known.Name, net.Name)
+		}
+	}
+	// 版本0的数据库没有版本记录
+	data, err := store.GetMeta(db.VersionKey)
+	if errors.Is(err, db.ErrNotFound) || err == nil && len(data) == 4 && binary.BigEndian.Uint32(data) < 2 {
+		return ErrLegacyDatabase
+	}
+	return fmt.Errorf("创世块与%s网络不符，拒绝打开", net.Name)
+}
+
+// 从数据库加载未花费输出集合
+// 索引缺失或与链尾不符（如旧版本创建的数据库）时，按内存中的区块重建并写回
+func (bc *Blockchain) loadChainState() error {
+	tip := bc.tipHash()
+	indexTip, err := bc.store.GetMeta(indexTipKey)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if bytes.Equal(indexTip, tip[:]) {
+		view := make(utxoView)
+		err := bc.store.ForEachIndex(utxoIndex, func(key, value []byte) error {
+			e, err := decodeUTXOEntry(value)
+			if err != nil {
+				return fmt.Errorf("未花费输出 %x: %w", key, err)
+			}
+			view[string(key)] = e
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		bc.utxos = view
+		return nil
+	}
+	if bc.pruned > 0 {
+		return fmt.Errorf("索引与链尾不符，且旧区块已被裁剪，无法重建: %w", ErrPruned)
+	}
+	return bc.reindex()
+}
+
+// 按内存中的区块重建未花费输出集合、撤销记录与交易索引，在一个批次中替换数据库中的旧索引
+func (bc *Blockchain) reindex() error {
+	batch := db.NewBatch()
+	for _, index := range []string{utxoIndex, txIndex, undoIndex} {
+		err := bc.store.ForEachIndex(index, func(key, _ []byte) error {
+			batch.DeleteIndex(index, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	view := make(utxoView)
+	for height, block := range bc.Blocks {
+		hash := block.CalculateHash()
+		undo := connectWithUndo(view, block, height)
+		batch.PutIndex(undoIndex, hash[:], undo.encode())
+		for _, t := range block.Transactions {
+			batch.PutIndex(txIndex, t.ID, hash[:])
+		}
+	}
+	for key, e := range view {
+		batch.PutIndex(utxoIndex, []byte(key), encodeUTXOEntry(e))
+	}
+	tip := bc.tipHash()
+	batch.PutMeta(indexTipKey, tip[:])
+	if err := bc.store.Write(batch); err != nil {
+		return err
+	}
+	bc.utxos = view
+	return nil
+}
+
+// 链上的一个未花费输出
+type UTXO struct {
+	TxID []byte
+	Vout int
+	tx.TXOutput
+	Height   int  // 所在区块高度
+	Coinbase bool // 是否为挖矿奖励
+}
+
+func newUTXO(key string, e utxoEntry) UTXO {
+	n := len(key) - 4
+	return UTXO{
+		TxID:     []byte(key[:n]),
+		Vout:     int(binary.BigEndian.Uint32([]byte(key[n:]))),
+		TXOutput: e.TXOutput,
+		Height:   e.Height,
+		Coinbase: e.Coinbase,
+	}
+}
+
+// 查找属于pubKeyHash的所有未花费输出，按高度、交易ID与输出序号排序
+// 基于未花费输出集合，不需要完整的区块，裁剪后同样可用
+func (bc *Blockchain) FindUTXO(pubKeyHash []byte) []UTXO {
+	bc.mu.RLock()
+	var utxos []UTXO
+	for key, e := range bc.utxos {
+		if bytes.Equal(e.PubKeyHash, pubKeyHash) {
+			utxos = append(utxos, newUTXO(key, e))
+		}
+	}
+	bc.mu.RUnlock()
+	slices.SortFunc(utxos, func(a, b UTXO) int {
+		return cmp.Or(cmp.Compare(a.Height, b.Height), bytes.Compare(a.TxID, b.TxID), cmp.Compare(a.Vout, b.Vout))
+	})
+	return utxos
+}
+
+// 查找给定输出，已被花费或不存在时返回false
+func (bc *Blockchain) GetUTXO(txid []byte, vout int) (UTXO, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	key := outpointKey(txid, vout)
+	e, ok := bc.utxos[key]
+	if !ok {
+		return UTXO{}, false
+	}
+	return newUTXO(key, e), true
+}
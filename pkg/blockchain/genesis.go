@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/merkle"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+// 网络参数：不同网络的创世块不同，彼此的链互不兼容
+// 复制后可调整CoinbaseMaturity等共识参数，创世块不变；MerkleMode影响创世块，需通过WithMerkleMode修改
+type Network struct {
+	Name             string
+	ID               uint32      // 网络标识，写入数据库用于区分
+	Bits             [4]byte     // 区块难度值
+	GenesisHash      [32]byte    // 创世块哈希，启动时校验
+	CoinbaseMaturity int         // Coinbase输出须经过的确认数，之后才能花费
+	MerkleMode       merkle.Mode // Merkle根的计算方式，决定区块版本，见BlockVersion
+
+	genesisTime    uint32
+	genesisNounce  uint32
+	genesisMessage string
+}
+
+var (
+	// 主网络，默认使用
+	MainNet = &Network{
+		Name:             "main",
+		ID:               0xacb00c01,
+		Bits:             pow.DefaultBits,
+		GenesisHash:      mustHash("0000f414474c38f6eca5a8e137e405e0e36a5e1efa5d8008b51401502b116704"),
+		CoinbaseMaturity: 10,
+		genesisTime:      1750000000,
+		genesisNounce:    106353,
+		genesisMessage:   "Blockchain-AccountBook genesis block",
+	}
+	// 测试网络，供实验与测试使用
+	TestNet = &Network{
+		Name:             "test",
+		ID:               0xacb00c02,
+		Bits:             pow.DefaultBits,
+		GenesisHash:      mustHash("00006b8d91746b83af11d30670273df66acea8def8501caf5cec13e79741d6be"),
+		CoinbaseMaturity: 2,
+		genesisTime:      1750000000,
+		genesisNounce:    1128,
+		genesisMessage:   "Blockchain-AccountBook test network genesis block",
+	}
+)
+
+// 启动时确认硬编码的创世块哈希与按参数构造出的创世块一致
+func init() {
+	for _, net := range []*Network{MainNet, TestNet} {
+		if hash := net.GenesisBlock().CalculateHash(); hash != net.GenesisHash {
+			panic(fmt.Sprintf("%s网络创世块哈希不符: 期望%x，实际%x", net.Name, net.GenesisHash, hash))
+		}
+	}
+}
+
+// 构造创世块
+// 创世Coinbase的奖励发往全零公钥哈希，任何人都无法花费
+func (net *Network) GenesisBlock() *pow.Block {
+	coinbase := &tx.Transaction{
+		Version: tx.TxVersion,
+		Inputs:  []tx.TXInput{{Txid: []byte{}, Vout: -1, Signature: []byte{}, PubKey: []byte(net.genesisMessage), Sequence: tx.SequenceFinal}},
+		Outputs: []tx.TXOutput{{Value: tx.BlockSubsidy, PubKeyHash: make([]byte, 20)}},
+	}
+	coinbase.ID = coinbase.CalcID()
+	transactions := []*tx.Transaction{coinbase}
+	block := &pow.Block{
+		PreviousHash: [32]byte{},
+		Timestamp:    net.genesisTime,
+		Bits:         net.Bits,
+		Nounce:       net.genesisNounce,
+		Transactions: transactions,
+	}
+	block.SetVersion(net.BlockVersion())
+	return block
+}
+
+// 该网络的区块版本：merkle.Bitcoin对应pow.BlockVersionBitcoinMerkle
+func (net *Network) BlockVersion() uint32 {
+	if net.MerkleMode == merkle.Bitcoin {
+		return pow.BlockVersionBitcoinMerkle
+	}
+	return pow.BlockVersion
+}
+
+// 复制网络参数，改用给定的Merkle根计算方式并重新挖掘创世块
+// 得到的是一个新网络，与原网络的链互不兼容，name与id应与已有网络不同
+func (net *Network) WithMerkleMode(mode merkle.Mode, name string, id uint32) *Network {
+	n := *net
+	n.Name, n.ID, n.MerkleMode = name, id, mode
+	genesis := n.GenesisBlock()
+	n.GenesisHash = genesis.MineBlock()
+	n.genesisTime, n.genesisNounce = genesis.Timestamp, genesis.Nounce
+	return &n
+}
+
+func mustHash(s string) [32]byte {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		panic("无效的哈希常量: " + s)
+	}
+	return [32]byte(b)
+}
@@ -0,0 +1,234 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+// 交易池准入策略：比共识规则更严格，只影响交易能否进入交易池，不影响区块合法性
+type Policy struct {
+	DustThreshold            tx.Amount // 金额低于该值的输出视为粉尘
+	MinRelayFeePerKB         tx.Amount // 每1000字节的最低手续费
+	IncrementalRelayFeePerKB tx.Amount // 替换交易须额外支付的每1000字节手续费
+	MaxReplacements          int       // 一笔替换交易最多替换的交易数
+	MaxAncestors             int       // 交易连同其未确认祖先的最大数量
+	MaxDescendants           int       // 未确认交易连同其后代的最大数量
+	MaxStandardTxSize        int       // 标准交易的最大字节数
+	MaxStandardTxSigOps      int       // 标准交易的签名检查次数上限
+}
+
+// 默认准入策略
+var DefaultPolicy = Policy{
+	DustThreshold:            tx.Cent,
+	MinRelayFeePerKB:         tx.Cent,
+	IncrementalRelayFeePerKB: tx.Cent,
+	MaxReplacements:          100,
+	MaxAncestors:             25,
+	MaxDescendants:           25,
+	MaxStandardTxSize:        100_000,
+	MaxStandardTxSigOps:      MaxBlockSigOps / 5,
+}
+
+// 给定大小的交易应付的最低手续费（向上取整）
+func (p Policy) MinFee(size int) tx.Amount {
+	return tx.FeeForSize(p.MinRelayFeePerKB, size)
+}
+
+// 替换手续费合计为replacedFees的交易时，大小为size的新交易应付的最低手续费
+func (p Policy) ReplacementFee(replacedFees tx.Amount, size int) tx.Amount {
+	return replacedFees + tx.FeeForSize(p.IncrementalRelayFeePerKB, size)
+}
+
+// 检查交易是否符合标准交易规则
+func (p Policy) CheckStandard(t *tx.Transaction) error {
+	if size := t.Size(); size > p.MaxStandardTxSize {
+		return fmt.Errorf("交易大小%d超过标准上限%d", size, p.MaxStandardTxSize)
+	}
+	if sigOps := t.SigOps(); sigOps > p.MaxStandardTxSigOps {
+		return fmt.Errorf("交易签名检查次数%d超过标准上限%d", sigOps, p.MaxStandardTxSigOps)
+	}
+	for idx, out := range t.Outputs {
+		if out.Value < p.DustThreshold {
+			return fmt.Errorf("输出#%d金额%s低于粉尘阈值%s", idx, out.Value, p.DustThreshold)
+		}
+	}
+	return nil
+}
+
+// 按准入策略检查交易，通过后加入交易池
+// 尚未到达时间锁的交易也可进入交易池，生效后才会被选入区块模板
+// 与交易池中的交易花费相同输出时，按替换规则决定是否替换（RBF）
+// 可以花费交易池中交易的输出，未确认的祖先与后代数量受MaxAncestors、MaxDescendants限制
+func (p *TxPool) AcceptTx(bc *Blockchain, t *tx.Transaction) error {
+	policy := p.GetPolicy()
+	if t.IsCoinbase() {
+		return errors.New("Coinbase交易不能进入交易池")
+	}
+	if err := policy.CheckStandard(t); err != nil {
+		return err
+	}
+	bc.mu.RLock()
+	view, height := bc.utxoView(), len(bc.Blocks)
+	bc.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slices.ContainsFunc(p.Transactions, func(pooled *tx.Transaction) bool { return bytes.Equal(pooled.ID, t.ID) }) {
+		return errors.New("交易已在交易池中")
+	}
+	view.addUnconfirmed(p.Transactions, height)
+	fee, err := view.checkTx(t)
+	if err != nil {
+		return err
+	}
+	if err := view.checkMaturity(t, height, bc.Net.CoinbaseMaturity); err != nil {
+		return err
+	}
+	if minFee := policy.MinFee(t.Size()); fee < minFee {
+		return fmt.Errorf("手续费%s低于最低转发费%s", fee, minFee)
+	}
+
+	// 与新交易冲突的交易连同其后代一并被替换
+	g := newTxGraph(p.Transactions)
+	spent := make(map[string]bool)
+	for _, vin := range t.Inputs {
+		spent[outpointKey(vin.Txid, vin.Vout)] = true
+	}
+	evicted := make(map[string]bool)
+	for _, pooled := range p.Transactions {
+		if conflicts(pooled, spent) {
+			evicted[string(pooled.ID)] = true
+			for _, d := range g.descendants(string(pooled.ID)) {
+				evicted[d] = true
+			}
+		}
+	}
+	var replaced, remaining []*tx.Transaction
+	for _, pooled := range p.Transactions {
+		if evicted[string(pooled.ID)] {
+			replaced = append(replaced, pooled)
+		} else {
+			remaining = append(remaining, pooled)
+		}
+	}
+	for _, vin := range t.Inputs {
+		if evicted[string(vin.Txid)] {
+			return errors.New("交易不能花费被它替换的交易的输出")
+		}
+	}
+	if len(replaced) > 0 {
+		if err := policy.checkReplacement(view, t, fee, replaced); err != nil {
+			return err
+		}
+	}
+	if err := policy.checkChainLimits(newTxGraph(append(remaining, t)), string(t.ID)); err != nil {
+		return err
+	}
+
+	if len(replaced) > 0 {
+		p.removeLocked(replaced)
+	}
+	p.Transactions = append(p.Transactions, t)
+	p.version++
+	return nil
+}
+
+// 不按准入策略（最低转发费、标准性、替换规则）重新加入交易，用于断开链尾区块后恢复其中的交易与原交易池
+// 交易仍须能在链上与交易池中交易的输出之上执行、花费的Coinbase已成熟，且不与交易池中的交易花费相同的输出
+func (p *TxPool) RestoreTx(bc *Blockchain, t *tx.Transaction) error {
+	if t.IsCoinbase() {
+		return errors.New("Coinbase交易不能进入交易池")
+	}
+	bc.mu.RLock()
+	view, height := bc.utxoView(), len(bc.Blocks)
+	bc.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slices.ContainsFunc(p.Transactions, func(pooled *tx.Transaction) bool { return bytes.Equal(pooled.ID, t.ID) }) {
+		return errors.New("交易已在交易池中")
+	}
+	view.addUnconfirmed(p.Transactions, height)
+	if _, err := view.checkTx(t); err != nil {
+		return err
+	}
+	if err := view.checkMaturity(t, height, bc.Net.CoinbaseMaturity); err != nil {
+		return err
+	}
+	spent := make(map[string]bool)
+	for _, pooled := range p.Transactions {
+		for _, vin := range pooled.Inputs {
+			spent[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+	if conflicts(t, spent) {
+		return errors.New("与交易池中的交易花费相同的输出")
+	}
+	p.Transactions = append(p.Transactions, t)
+	p.version++
+	return nil
+}
+
+// 检查交易的未确认祖先数量，以及加入后每个祖先的后代数量
+func (p Policy) checkChainLimits(g *txGraph, id string) error {
+	ancestors := g.ancestors(id)
+	if len(ancestors)+1 > p.MaxAncestors {
+		return fmt.Errorf("未确认的祖先交易过多（%d笔，上限%d）", len(ancestors)+1, p.MaxAncestors)
+	}
+	for _, a := range ancestors {
+		if n := len(g.descendants(a)) + 1; n > p.MaxDescendants {
+			return fmt.Errorf("祖先交易 %x 的后代过多（%d笔，上限%d）", a, n, p.MaxDescendants)
+		}
+	}
+	return nil
+}
+
+// 替换规则（参考BIP125）：
+// 被替换的交易都须声明可替换，且数量不超过MaxReplacements；
+// 新交易的手续费须覆盖被替换交易的手续费之和，并额外支付自身大小对应的增量手续费；
+// 新交易的费率须高于每笔被替换的交易
+func (p Policy) checkReplacement(view utxoView, t *tx.Transaction, fee tx.Amount, replaced []*tx.Transaction) error {
+	if len(replaced) > p.MaxReplacements {
+		return fmt.Errorf("替换的交易数%d超过上限%d", len(replaced), p.MaxReplacements)
+	}
+	var replacedFees tx.Amount
+	for _, old := range replaced {
+		if !old.SignalsReplacement() {
+			return fmt.Errorf("与交易池中不可替换的交易 %x 冲突", old.ID)
+		}
+		oldFee := view.fee(old)
+		// 费率比较：fee/size > oldFee/oldSize
+		if fee*tx.Amount(old.Size()) <= oldFee*tx.Amount(t.Size()) {
+			return fmt.Errorf("费率不高于被替换的交易 %x", old.ID)
+		}
+		replacedFees += oldFee
+	}
+	if minFee := p.ReplacementFee(replacedFees, t.Size()); fee < minFee {
+		return fmt.Errorf("替换交易的手续费%s低于要求的%s", fee, minFee)
+	}
+	return nil
+}
+
+// 按视图计算交易手续费，不做校验
+func (v utxoView) fee(t *tx.Transaction) tx.Amount {
+	var fee tx.Amount
+	for _, vin := range t.Inputs {
+		fee += v[outpointKey(vin.Txid, vin.Vout)].Value
+	}
+	for _, out := range t.Outputs {
+		fee -= out.Value
+	}
+	return fee
+}
+
+// 交易池使用的准入策略，未设置时为DefaultPolicy
+func (p *TxPool) GetPolicy() Policy {
+	if p.Policy != nil {
+		return *p.Policy
+	}
+	return DefaultPolicy
+}
@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 区块内容已被裁剪，只保留区块头
+var ErrPruned = errors.New("区块已被裁剪")
+
+// 裁剪后至少保留完整内容的最近区块数，保证最近的区块可以断开
+const MinPruneKeep = 10
+
+// 记录裁剪进度的元数据键：高度低于该值的区块只保留区块头
+const pruneHeightKey = "pruneHeight"
+
+// 记录裁剪设置的元数据键：Depth(8) MaxSize(8)，大端序
+const pruneConfigKey = "pruneConfig"
+
+// 裁剪设置：超出深度或大小预算的旧区块只保留区块头，其撤销记录与交易索引一并删除
+// 未花费输出集合不受影响，余额查询与新交易照常进行
+type PruneConfig struct {
+	Depth   int // 保留最近Depth个区块的完整内容，<=0时不按深度裁剪
+	MaxSize int // 保留完整内容的区块总字节数上限，<=0时不按大小裁剪
+}
+
+// 应保留完整内容的第一个区块高度，至少保留MinPruneKeep个
+func (c PruneConfig) keepFrom(blocks []*pow.Block) int {
+	keep := len(blocks)
+	if c.Depth > 0 {
+		keep = min(keep, c.Depth)
+	}
+	if c.MaxSize > 0 {
+		size, n := 0, 0
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if size += blocks[i].Size(); size > c.MaxSize {
+				break
+			}
+			n++
+		}
+		keep = min(keep, n)
+	}
+	return max(len(blocks)-max(keep, MinPruneKeep), 0)
+}
+
+// 把[bc.pruned, to)区间的区块裁剪写入batch，返回裁剪后的区块列表
+func (bc *Blockchain) pruneBatch(batch *db.Batch, blocks []*pow.Block, to int) []*pow.Block {
+	if to <= bc.pruned {
+		return blocks
+	}
+	blocks = slices.Clone(blocks)
+	for height := bc.pruned; height < to; height++ {
+		block := blocks[height]
+		hash := block.CalculateHash()
+		header := block.Header()
+		batch.PutBlock(hash[:], header)
+		batch.DeleteIndex(undoIndex, hash[:])
+		for _, t := range block.Transactions {
+			batch.DeleteIndex(txIndex, t.ID)
+		}
+		blocks[height] = header
+	}
+	batch.PutMeta(pruneHeightKey, binary.BigEndian.AppendUint32(nil, uint32(to)))
+	return blocks
+}
+
+// 设置并保存裁剪设置，重新打开数据库后仍然有效，之后每接入一个区块都按该设置裁剪
+// cfg为nil时停止裁剪，已裁剪的区块不会恢复
+func (bc *Blockchain) SetPrune(cfg *PruneConfig) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	batch := db.NewBatch()
+	if cfg == nil {
+		batch.DeleteMeta(pruneConfigKey)
+	} else {
+		cfg = &PruneConfig{Depth: cfg.Depth, MaxSize: cfg.MaxSize}
+		data := binary.BigEndian.AppendUint64(nil, uint64(cfg.Depth))
+		batch.PutMeta(pruneConfigKey, binary.BigEndian.AppendUint64(data, uint64(cfg.MaxSize)))
+	}
+	if err := bc.store.Write(batch); err != nil {
+		return fmt.Errorf("保存裁剪设置失败: %w", err)
+	}
+	bc.Prune = cfg
+	return nil
+}
+
+// 按Prune设置立即裁剪旧区块，返回本次裁剪的区块数
+func (bc *Blockchain) PruneBlocks() (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.Prune == nil {
+		return 0, errors.New("未启用裁剪")
+	}
+	to := bc.Prune.keepFrom(bc.Blocks)
+	if to <= bc.pruned {
+		return 0, nil
+	}
+	batch := db.NewBatch()
+	blocks := bc.pruneBatch(batch, bc.Blocks, to)
+	if err := bc.store.Write(batch); err != nil {
+		return 0, fmt.Errorf("裁剪区块失败: %w", err)
+	}
+	n := to - bc.pruned
+	bc.Blocks, bc.pruned = blocks, to
+	return n, nil
+}
+
+// 高度低于该值的区块已被裁剪
+func (bc *Blockchain) PruneHeight() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.pruned
+}
+
+// 读取给定高度的完整区块，已被裁剪时返回ErrPruned
+func (bc *Blockchain) GetBlock(height int) (*pow.Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= len(bc.Blocks) {
+		return nil, fmt.Errorf("区块高度%d超出范围", height)
+	}
+	if height < bc.pruned {
+		return nil, fmt.Errorf("区块 #%d: %w", height, ErrPruned)
+	}
+	return bc.Blocks[height], nil
+}
+
+// 从数据库读取裁剪进度
+func (bc *Blockchain) loadPruneHeight() error {
+	data, err := bc.store.GetMeta(pruneHeightKey)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) != 4 {
+		return fmt.Errorf("裁剪进度记录无效: %x", data)
+	}
+	bc.pruned = int(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+// 从数据库读取SetPrune保存的裁剪设置
+func (bc *Blockchain) loadPruneConfig() error {
+	data, err := bc.store.GetMeta(pruneConfigKey)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) != 16 {
+		return fmt.Errorf("裁剪设置记录无效: %x", data)
+	}
+	bc.Prune = &PruneConfig{
+		Depth:   int(int64(binary.BigEndian.Uint64(data))),
+		MaxSize: int(int64(binary.BigEndian.Uint64(data[8:]))),
+	}
+	return nil
+}
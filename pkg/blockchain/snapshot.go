@@ -0,0 +1,346 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 未花费输出快照格式：
+//
+//	魔数"ABUS" 版本(4) 网络ID(4) 链尾高度(4)
+//	区块头：从创世块到链尾，每个为长度(4) + 只含区块头的pow.Block.Serialize结果
+//	未花费输出：条数(4)，按键的字节序排列，每条为键长(4) 键 值长(4) 值（与数据库utxo索引相同）
+//	承诺哈希(32)：见UTXOCommitment
+//	校验和：之前所有字节的SHA-256(32)
+//
+// 数值均为大端序
+var snapshotMagic = [4]byte{'A', 'B', 'U', 'S'}
+
+const snapshotVersion = 1
+
+// 记录快照来源的元数据键：快照高度(4) 承诺哈希(32) 历史是否已验证(1)
+const snapshotKey = "snapshot"
+
+// 通过快照启动的链的信息
+type SnapshotInfo struct {
+	Height     int      // 快照对应的链尾高度
+	Commitment [32]byte // 快照的承诺哈希
+	Verified   bool     // 快照之前的历史区块是否已完整验证
+}
+
+// 未花费输出集合的承诺哈希：对链尾哈希与按键排序的全部未花费输出计算SHA-256
+// 与区块存储方式、裁剪状态无关，同一链尾的两个节点得到相同的结果
+func (bc *Blockchain) UTXOCommitment() [32]byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return utxoCommitment(bc.tipHash(), snapshotEntries(bc.utxos))
+}
+
+// 一条快照中的未花费输出
+type snapshotEntry struct {
+	key, value []byte
+}
+
+// 按键排序的未花费输出
+func snapshotEntries(view utxoView) []snapshotEntry {
+	keys := slices.Sorted(maps.Keys(view))
+	entries := make([]snapshotEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = snapshotEntry{[]byte(key), encodeUTXOEntry(view[key])}
+	}
+	return entries
+}
+
+func utxoCommitment(tip [32]byte, entries []snapshotEntry) [32]byte {
+	h := sha256.New()
+	h.Write(tip[:])
+	for _, e := range entries {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(e.key))))
+		h.Write(e.key)
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(e.value))))
+		h.Write(e.value)
+	}
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// 写出链尾处的未花费输出快照，返回其承诺哈希
+// 承诺哈希需通过可信渠道交给使用快照的一方，加载时据此确认快照内容
+func (bc *Blockchain) WriteUTXOSnapshot(w io.Writer) ([32]byte, error) {
+	bc.mu.RLock()
+	headers := make([]*pow.Block, len(bc.Blocks))
+	for i, block := range bc.Blocks {
+		headers[i] = block.Header()
+	}
+	entries := snapshotEntries(bc.utxos)
+	bc.mu.RUnlock()
+	commitment := utxoCommitment(headers[len(headers)-1].CalculateHash(), entries)
+
+	bw := bufio.NewWriter(w)
+	fw := &hashWriter{w: bw, h: sha256.New()}
+	head := binary.BigEndian.AppendUint32(snapshotMagic[:], snapshotVersion)
+	head = binary.BigEndian.AppendUint32(head, bc.Net.ID)
+	head = binary.BigEndian.AppendUint32(head, uint32(len(headers)-1))
+	fw.Write(head)
+	for _, header := range headers {
+		data := header.Serialize()
+		fw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+		fw.Write(data)
+	}
+	fw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(entries))))
+	for _, e := range entries {
+		fw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(e.key))))
+		fw.Write(e.key)
+		fw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(e.value))))
+		fw.Write(e.value)
+	}
+	fw.Write(commitment[:])
+	if fw.err != nil {
+		return commitment, fw.err
+	}
+	if _, err := bw.Write(fw.h.Sum(nil)); err != nil {
+		return commitment, err
+	}
+	return commitment, bw.Flush()
+}
+
+// 读取快照文件，检查格式、网络、校验和与区块头链
+func readUTXOSnapshot(r io.Reader, net *Network) ([]*pow.Block, []snapshotEntry, [32]byte, error) {
+	var commitment [32]byte
+	fr := &hashReader{r: bufio.NewReader(r), h: sha256.New()}
+	head := fr.next(16)
+	if fr.err != nil {
+		return nil, nil, commitment, fmt.Errorf("读取文件头失败: %w", fr.err)
+	}
+	if !bytes.Equal(head[:4], snapshotMagic[:]) {
+		return nil, nil, commitment, errors.New("不是未花费输出快照")
+	}
+	if v := binary.BigEndian.Uint32(head[4:]); v != snapshotVersion {
+		return nil, nil, commitment, fmt.Errorf("不支持的快照版本%d", v)
+	}
+	if id := binary.BigEndian.Uint32(head[8:]); id != net.ID {
+		return nil, nil, commitment, fmt.Errorf("快照属于网络%08x，与%s网络（%08x）不符", id, net.Name, net.ID)
+	}
+	height := binary.BigEndian.Uint32(head[12:])
+
+	var headers []*pow.Block
+	for i := uint32(0); i <= height; i++ {
+		size := binary.BigEndian.Uint32(fr.next(4))
+		if fr.err == nil && size > maxFileBlockSize {
+			return nil, nil, commitment, fmt.Errorf("区块头 #%d 长度%d超出上限", i, size)
+		}
+		data := fr.next(int(size))
+		if fr.err != nil {
+			return nil, nil, commitment, fmt.Errorf("读取区块头 #%d 失败: %w", i, fr.err)
+		}
+		header, err := pow.DeserializeBlock(data)
+		if err != nil {
+			return nil, nil, commitment, fmt.Errorf("区块头 #%d: %w", i, err)
+		}
+		if len(header.Transactions) != 0 {
+			return nil, nil, commitment, fmt.Errorf("区块头 #%d 含有交易", i)
+		}
+		headers = append(headers, header)
+	}
+	var entries []snapshotEntry
+	for n := binary.BigEndian.Uint32(fr.next(4)); n > 0 && fr.err == nil; n-- {
+		var e snapshotEntry
+		for _, field := range []*[]byte{&e.key, &e.value} {
+			size := binary.BigEndian.Uint32(fr.next(4))
+			if fr.err == nil && size > maxFileBlockSize {
+				return nil, nil, commitment, fmt.Errorf("未花费输出长度%d超出上限", size)
+			}
+			*field = fr.next(int(size))
+		}
+		entries = append(entries, e)
+	}
+	copy(commitment[:], fr.next(32))
+	if fr.err != nil {
+		return nil, nil, commitment, fmt.Errorf("读取快照失败: %w", fr.err)
+	}
+	sum := fr.h.Sum(nil)
+	var checksum [32]byte
+	if _, err := io.ReadFull(fr.r, checksum[:]); err != nil {
+		return nil, nil, commitment, fmt.Errorf("读取校验和失败: %w", err)
+	}
+	if !bytes.Equal(sum, checksum[:]) {
+		return nil, nil, commitment, errors.New("校验和不符，文件已损坏")
+	}
+	if err := checkHeaders(headers, net); err != nil {
+		return nil, nil, commitment, err
+	}
+	return headers, entries, commitment, nil
+}
+
+// 检查区块头从创世块开始依次相连，且满足难度要求
+func checkHeaders(headers []*pow.Block, net *Network) error {
+	if len(headers) == 0 || headers[0].CalculateHash() != net.GenesisHash {
+		return fmt.Errorf("快照的创世块与%s网络不符", net.Name)
+	}
+	for i := 1; i < len(headers); i++ {
+		header := headers[i]
+		if header.PreviousHash != headers[i-1].CalculateHash() {
+			return fmt.Errorf("区块头 #%d 与前一区块不相连", i)
+		}
+		if header.Bits != net.Bits {
+			return fmt.Errorf("区块头 #%d 难度值不正确", i)
+		}
+		hash := header.CalculateHash()
+		target := pow.BitsToTarget(header.Bits)
+		if bytes.Compare(hash[:], target[:]) > 0 {
+			return fmt.Errorf("区块头 #%d 哈希不满足难度要求", i)
+		}
+	}
+	return nil
+}
+
+// 从可信的未花费输出快照启动区块链，store须为空
+// 快照内容的承诺哈希须与trusted一致；快照之前的区块只有区块头，视为已裁剪，
+// 之后可用VerifyHistory对照完整的区块文件验证这段历史
+func NewBlockchainFromSnapshot(store db.Store, r io.Reader, trusted [32]byte, network ...*Network) (*Blockchain, error) {
+	net := MainNet
+	if len(network) > 0 {
+		net = network[0]
+	}
+	if _, err := store.GetTip(); !errors.Is(err, db.ErrNotFound) {
+		if err == nil {
+			err = errors.New("数据库中已有区块")
+		}
+		return nil, fmt.Errorf("只能在空数据库上加载快照: %w", err)
+	}
+	headers, entries, commitment, err := readUTXOSnapshot(r, net)
+	if err != nil {
+		return nil, err
+	}
+	tip := headers[len(headers)-1].CalculateHash()
+	if utxoCommitment(tip, entries) != commitment {
+		return nil, errors.New("快照内容与其承诺哈希不符")
+	}
+	if commitment != trusted {
+		return nil, fmt.Errorf("快照承诺哈希%x与可信值%x不符", commitment, trusted)
+	}
+
+	view := make(utxoView)
+	batch := db.NewBatch()
+	for _, e := range entries {
+		if len(e.key) <= 4 {
+			return nil, fmt.Errorf("未花费输出的键无效: %x", e.key)
+		}
+		entry, err := decodeUTXOEntry(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("未花费输出 %x: %w", e.key, err)
+		}
+		view[string(e.key)] = entry
+		batch.PutIndex(utxoIndex, e.key, e.value)
+	}
+	for _, header := range headers {
+		hash := header.CalculateHash()
+		batch.PutBlock(hash[:], header)
+	}
+	info := SnapshotInfo{Height: len(headers) - 1, Commitment: commitment}
+	batch.SetTip(tip[:])
+	batch.PutMeta(indexTipKey, tip[:])
+	batch.PutMeta(pruneHeightKey, binary.BigEndian.AppendUint32(nil, uint32(len(headers))))
+	batch.PutMeta(snapshotKey, info.encode())
+	batch.PutMeta(db.NetworkKey, binary.BigEndian.AppendUint32(nil, net.ID))
+	if err := store.Write(batch); err != nil {
+		return nil, err
+	}
+	return &Blockchain{
+		Blocks: headers,
+		Net:    net,
+		store:  store,
+		utxos:  view,
+		pruned: len(headers),
+	}, nil
+}
+
+func (s SnapshotInfo) encode() []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(s.Height))
+	buf = append(buf, s.Commitment[:]...)
+	if s.Verified {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+// 链由快照启动时返回快照信息，否则返回false
+func (bc *Blockchain) Snapshot() (SnapshotInfo, bool, error) {
+	data, err := bc.store.GetMeta(snapshotKey)
+	if errors.Is(err, db.ErrNotFound) {
+		return SnapshotInfo{}, false, nil
+	}
+	if err != nil {
+		return SnapshotInfo{}, false, err
+	}
+	if len(data) != 4+32+1 {
+		return SnapshotInfo{}, false, fmt.Errorf("快照记录无效: %x", data)
+	}
+	info := SnapshotInfo{
+		Height:   int(binary.BigEndian.Uint32(data)),
+		Verified: data[36] == 1,
+	}
+	copy(info.Commitment[:], data[4:36])
+	return info, true, nil
+}
+
+// 用完整的区块文件验证快照之前的历史：在内存中从创世块起完整校验并执行区块，
+// 确认每个区块与本链的区块头一致，且快照高度处的未花费输出承诺哈希与快照相同
+// 验证只读取本链的区块头，可在后台与其他操作同时进行；通过后记录到数据库
+func (bc *Blockchain) VerifyHistory(r io.Reader) error {
+	info, ok, err := bc.Snapshot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("区块链不是由快照启动的")
+	}
+	if info.Verified {
+		return nil
+	}
+	blocks, err := ReadChainFile(r, bc.Net)
+	if err != nil {
+		return err
+	}
+	if len(blocks) <= info.Height {
+		return fmt.Errorf("区块文件只有%d个区块，不足快照高度%d", len(blocks), info.Height)
+	}
+
+	replay, err := NewBlockchainWithStore(db.NewMemStore(), bc.Net)
+	if err != nil {
+		return err
+	}
+	defer replay.Close()
+	for height := 1; height <= info.Height; height++ {
+		if _, err := replay.importBlock(height, blocks[height]); err != nil {
+			return fmt.Errorf("区块 #%d: %w", height, err)
+		}
+	}
+	bc.mu.RLock()
+	headers := bc.Blocks[: info.Height+1 : info.Height+1]
+	bc.mu.RUnlock()
+	for height, block := range replay.GetBlocks() {
+		if block.CalculateHash() != headers[height].CalculateHash() {
+			return fmt.Errorf("区块 #%d 与快照的区块头不符", height)
+		}
+	}
+	if replay.UTXOCommitment() != info.Commitment {
+		return errors.New("按历史区块计算的未花费输出与快照不符")
+	}
+
+	info.Verified = true
+	batch := db.NewBatch()
+	batch.PutMeta(snapshotKey, info.encode())
+	return bc.store.Write(batch)
+}
@@ -0,0 +1,81 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+// 区块模板（类似比特币的getblocktemplate）
+// 外部矿工据此组装区块、自行挖矿，再通过SubmitBlock提交
+type BlockTemplate struct {
+	Version       uint32
+	PreviousHash  [32]byte
+	Bits          [4]byte
+	Height        int               // 新区块的高度
+	CurTime       uint32            // 建议使用的时间戳：本地时间，且大于MinTime
+	MinTime       uint32            // 区块时间戳须大于该值，即之前区块的中位时间
+	CoinbaseValue tx.Amount         // Coinbase可领取的金额：挖矿奖励+手续费
+	Fees          tx.Amount         // 所选交易的手续费总额
+	Transactions  []*tx.Transaction // 所选交易，不含Coinbase
+}
+
+// 从交易池中选取可上链的交易生成区块模板，maxTxs<=0时不限制交易数
+// 与当前链状态冲突的交易会被跳过
+func (bc *Blockchain) GetBlockTemplate(p *TxPool, maxTxs int) *BlockTemplate {
+	candidates := p.SelectTx(bc, 0)
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	tmpl := &BlockTemplate{
+		Version:      bc.Net.BlockVersion(),
+		PreviousHash: bc.tipHash(),
+		Bits:         bc.Net.Bits,
+		Height:       len(bc.Blocks),
+		MinTime:      bc.medianTimePast(),
+	}
+	tmpl.CurTime = max(uint32(time.Now().Unix()), tmpl.MinTime+1)
+	view := bc.utxoView()
+	for _, t := range candidates {
+		if maxTxs > 0 && len(tmpl.Transactions) >= maxTxs {
+			break
+		}
+		// 尚未生效的交易留在交易池中，等待之后的区块
+		if view.checkLocks(t, tmpl.Height, tmpl.MinTime) != nil || view.checkMaturity(t, tmpl.Height, bc.Net.CoinbaseMaturity) != nil {
+			continue
+		}
+		fee, err := view.checkTx(t)
+		if err != nil {
+			continue
+		}
+		view.connect([]*tx.Transaction{t}, tmpl.Height, tmpl.CurTime)
+		tmpl.Transactions = append(tmpl.Transactions, t)
+		tmpl.Fees += fee
+	}
+	tmpl.CoinbaseValue = tx.BlockSubsidy + tmpl.Fees
+	return tmpl
+}
+
+// 按模板组装待挖掘的区块，Coinbase奖励发往minerAddress
+// Coinbase中写入区块高度，避免同一地址多次获得奖励时交易ID重复
+func (t *BlockTemplate) NewBlock(minerAddress string) pow.Block {
+	data := fmt.Sprintf("Height %d reward to '%s'", t.Height, minerAddress)
+	coinbase := tx.NewCoinbaseTXWithValue(minerAddress, data, t.CoinbaseValue)
+	transactions := append([]*tx.Transaction{coinbase}, t.Transactions...)
+	block := pow.Block{
+		PreviousHash: t.PreviousHash,
+		Timestamp:    t.CurTime,
+		Bits:         t.Bits,
+		Transactions: transactions,
+	}
+	block.SetVersion(t.Version)
+	return block
+}
+
+// 校验外部挖出的区块，通过后接到链尾并存储
+// 与本地挖出的区块遵循同一套规则，见ConnectBlock
+func (bc *Blockchain) SubmitBlock(block *pow.Block) error {
+	return bc.ConnectBlock(block)
+}
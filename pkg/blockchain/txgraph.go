@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+// 交易池中未确认交易之间的依赖关系：子交易花费父交易的输出
+// 交易池按到达顺序保存交易，父交易总在子交易之前
+type txGraph struct {
+	txs      []*tx.Transaction
+	index    map[string]int      // 交易ID在txs中的位置
+	parents  map[string][]string // 直接父交易
+	children map[string][]string // 直接子交易
+}
+
+func newTxGraph(txs []*tx.Transaction) *txGraph {
+	g := &txGraph{
+		txs:      txs,
+		index:    make(map[string]int),
+		parents:  make(map[string][]string),
+		children: make(map[string][]string),
+	}
+	for i, t := range txs {
+		g.index[string(t.ID)] = i
+	}
+	for _, t := range txs {
+		id := string(t.ID)
+		for _, vin := range t.Inputs {
+			parent := string(vin.Txid)
+			if _, ok := g.index[parent]; !ok || parent == id || slices.Contains(g.parents[id], parent) {
+				continue
+			}
+			g.parents[id] = append(g.parents[id], parent)
+			g.children[parent] = append(g.children[parent], id)
+		}
+	}
+	return g
+}
+
+// 交易的所有祖先（不含自身），按交易池顺序排列，父交易在前
+func (g *txGraph) ancestors(id string) []string {
+	return g.closure(id, g.parents)
+}
+
+// 交易的所有后代（不含自身），按交易池顺序排列
+func (g *txGraph) descendants(id string) []string {
+	return g.closure(id, g.children)
+}
+
+func (g *txGraph) closure(id string, edges map[string][]string) []string {
+	seen := make(map[string]bool)
+	stack := slices.Clone(edges[id])
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		stack = append(stack, edges[n]...)
+	}
+	result := make([]string, 0, len(seen))
+	for n := range seen {
+		result = append(result, n)
+	}
+	slices.SortFunc(result, func(a, b string) int { return g.index[a] - g.index[b] })
+	return result
+}
+
+func (g *txGraph) tx(id string) *tx.Transaction {
+	return g.txs[g.index[id]]
+}
+
+// 将交易池中交易的输出加入视图，使子交易可以花费未确认的输出
+// 被交易池中交易花费的输出仍保留在视图中，冲突由替换规则处理
+func (v utxoView) addUnconfirmed(txs []*tx.Transaction, height int) {
+	now := uint32(time.Now().Unix())
+	for _, t := range txs {
+		for idx, out := range t.Outputs {
+			v[outpointKey(t.ID, idx)] = utxoEntry{TXOutput: out, Height: height, Time: now}
+		}
+	}
+}
+
+// 交易池中某笔交易的所有未确认祖先，父交易在前
+func (p *TxPool) Ancestors(id []byte) []*tx.Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g := newTxGraph(p.Transactions)
+	return g.lookup(g.ancestors(string(id)))
+}
+
+// 交易池中所有直接或间接花费某笔交易输出的交易
+func (p *TxPool) Descendants(id []byte) []*tx.Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g := newTxGraph(p.Transactions)
+	return g.lookup(g.descendants(string(id)))
+}
+
+func (g *txGraph) lookup(ids []string) []*tx.Transaction {
+	var txs []*tx.Transaction
+	for _, id := range ids {
+		txs = append(txs, g.tx(id))
+	}
+	return txs
+}
+
+// 交易池中交易的手续费，输入可以来自链上或交易池中的父交易
+func (p *TxPool) TxFee(bc *Blockchain, t *tx.Transaction) tx.Amount {
+	return p.poolView(bc).fee(t)
+}
+
+// 祖先包：交易连同其全部未确认祖先的手续费之和与大小之和
+// 选取交易打包时按包费率fee/size排序，子交易的高手续费可以带动父交易被打包（CPFP）
+func (p *TxPool) PackageFee(bc *Blockchain, id []byte) (tx.Amount, int) {
+	view := p.poolView(bc)
+	p.mu.Lock()
+	g := newTxGraph(slices.Clone(p.Transactions))
+	p.mu.Unlock()
+	if _, ok := g.index[string(id)]; !ok {
+		return 0, 0
+	}
+	return g.packageFee(string(id), view, nil)
+}
+
+// 计算祖先包的手续费与大小，已选中的祖先不再计入
+func (g *txGraph) packageFee(id string, view utxoView, selected map[string]bool) (tx.Amount, int) {
+	fee, size := view.fee(g.tx(id)), g.tx(id).Size()
+	for _, a := range g.ancestors(id) {
+		if !selected[a] {
+			fee += view.fee(g.tx(a))
+			size += g.tx(a).Size()
+		}
+	}
+	return fee, size
+}
+
+// 链上未花费输出加上交易池中交易的输出
+func (p *TxPool) poolView(bc *Blockchain) utxoView {
+	bc.mu.RLock()
+	view, height := bc.utxoView(), len(bc.Blocks)
+	bc.mu.RUnlock()
+	p.mu.Lock()
+	view.addUnconfirmed(p.Transactions, height)
+	p.mu.Unlock()
+	return view
+}
@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 区块的撤销记录：按交易、输入的顺序记录被花费的输出（金额、所有者、高度等）
+// 断开区块时按相反顺序恢复，得到接入该区块之前的未花费输出集合
+type blockUndo []utxoEntry
+
+// 依次执行区块中的交易，返回撤销记录
+// 同一区块内先创建后花费的输出也会被记录，断开时先恢复再随创建它的交易一起删除
+func connectWithUndo(view utxoView, block *pow.Block, height int) blockUndo {
+	var undo blockUndo
+	for _, t := range block.Transactions {
+		if !t.IsCoinbase() {
+			for _, vin := range t.Inputs {
+				undo = append(undo, view[outpointKey(vin.Txid, vin.Vout)])
+			}
+		}
+		view.connect([]*tx.Transaction{t}, height, block.Timestamp)
+	}
+	return undo
+}
+
+// 编码格式：条数(4)，之后每条为长度(4) + encodeUTXOEntry
+func (u blockUndo) encode() []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(u)))
+	for _, e := range u {
+		data := encodeUTXOEntry(e)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+func decodeBlockUndo(data []byte) (blockUndo, error) {
+	if len(data) < 4 {
+		return nil, errors.New("撤销记录长度不足")
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	undo := make(blockUndo, 0, n)
+	for range n {
+		if len(data) < 4 {
+			return nil, errors.New("撤销记录长度不足")
+		}
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint32(len(data)) < size {
+			return nil, errors.New("撤销记录长度不足")
+		}
+		e, err := decodeUTXOEntry(data[:size])
+		if err != nil {
+			return nil, err
+		}
+		undo = append(undo, e)
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return nil, errors.New("撤销记录末尾有多余数据")
+	}
+	return undo, nil
+}
+
+// 断开链尾区块：按撤销记录恢复其花费的输出，删除其创建的输出与交易索引，链尾回退到前一区块
+// 区块本身仍保留在数据库中；创世块不能断开。返回被断开的区块
+func (bc *Blockchain) DisconnectTip() (*pow.Block, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	n := len(bc.Blocks)
+	if n <= 1 {
+		return nil, errors.New("不能断开创世块")
+	}
+	if n-1 < bc.pruned {
+		return nil, fmt.Errorf("区块 #%d: %w，无法断开", n-1, ErrPruned)
+	}
+	block := bc.Blocks[n-1]
+	hash := block.CalculateHash()
+	data, err := bc.store.GetIndex(undoIndex, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("读取区块 %x 的撤销记录失败: %w", hash, err)
+	}
+	undo, err := decodeBlockUndo(data)
+	if err != nil {
+		return nil, fmt.Errorf("区块 %x 的撤销记录无效: %w", hash, err)
+	}
+
+	view := bc.utxoView()
+	batch := db.NewBatch()
+	// 按相反顺序处理交易与输入
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		t := block.Transactions[i]
+		for idx := range t.Outputs {
+			delete(view, outpointKey(t.ID, idx))
+			batch.DeleteIndex(utxoIndex, outpointBytes(t.ID, idx))
+		}
+		batch.DeleteIndex(txIndex, t.ID)
+		if t.IsCoinbase() {
+			continue
+		}
+		for j := len(t.Inputs) - 1; j >= 0; j-- {
+			if len(undo) == 0 {
+				return nil, fmt.Errorf("区块 %x 的撤销记录与交易不符", hash)
+			}
+			vin := t.Inputs[j]
+			e := undo[len(undo)-1]
+			undo = undo[:len(undo)-1]
+			view[outpointKey(vin.Txid, vin.Vout)] = e
+			batch.PutIndex(utxoIndex, outpointBytes(vin.Txid, vin.Vout), encodeUTXOEntry(e))
+		}
+	}
+	if len(undo) != 0 {
+		return nil, fmt.Errorf("区块 %x 的撤销记录与交易不符", hash)
+	}
+	batch.DeleteIndex(undoIndex, hash[:])
+	prev := block.PreviousHash
+	batch.SetTip(prev[:])
+	batch.PutMeta(indexTipKey, prev[:])
+	if err := bc.store.Write(batch); err != nil {
+		return nil, fmt.Errorf("断开区块失败: %w", err)
+	}
+
+	// 限制容量，之后追加的区块不会覆盖GetBlocks已返回的切片
+	bc.Blocks = bc.Blocks[: n-1 : n-1]
+	bc.utxos = view
+	return block, nil
+}
@@ -0,0 +1,292 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 区块的共识限制
+const (
+	MaxBlockSize   = 1_000_000 // 区块序列化后的最大字节数
+	MaxBlockSigOps = 20_000    // 区块内签名检查次数上限
+
+	MedianTimeSpan     = 11          // 计算中位时间（MTP）所用的最近区块数
+	MaxFutureBlockTime = 2 * 60 * 60 // 区块时间戳最多超前本地时间的秒数
+)
+
+// 区块时间戳不大于之前区块的中位时间
+var ErrTimeTooOld = errors.New("区块时间戳不大于最近区块的中位时间")
+
+// 区块时间戳超前本地时间过多
+var ErrTimeTooNew = errors.New("区块时间戳超前本地时间过多")
+
+// 链尾及之前共MedianTimeSpan个区块时间戳的中位数（MTP），调用方需持有读锁
+// 下一个区块的时间戳须大于MTP；交易的时间锁也按MTP判断，矿工无法靠调快时间戳提前打包锁定中的交易
+func (bc *Blockchain) medianTimePast() uint32 {
+	times := make([]uint32, 0, MedianTimeSpan)
+	for _, block := range bc.Blocks[max(0, len(bc.Blocks)-MedianTimeSpan):] {
+		times = append(times, block.Timestamp)
+	}
+	slices.Sort(times)
+	return times[len(times)/2]
+}
+
+// 当前链尾的中位时间，见medianTimePast
+func (bc *Blockchain) MedianTimePast() uint32 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.medianTimePast()
+}
+
+// 检查待接入链尾的区块的时间戳：须大于MTP，且最多超前本地时间MaxFutureBlockTime秒
+func (bc *Blockchain) checkTimestamp(block *pow.Block) error {
+	if mtp := bc.medianTimePast(); block.Timestamp <= mtp {
+		return fmt.Errorf("%w: %d <= %d", ErrTimeTooOld, block.Timestamp, mtp)
+	}
+	if limit := time.Now().Unix() + MaxFutureBlockTime; int64(block.Timestamp) > limit {
+		return fmt.Errorf("%w: %d > %d", ErrTimeTooNew, block.Timestamp, limit)
+	}
+	return nil
+}
+
+// 与链状态无关的区块检查：交易数量、大小、签名检查次数及每笔交易的合法性
+func checkBlockSanity(block *pow.Block) error {
+	if len(block.Transactions) == 0 {
+		return errors.New("区块不含交易")
+	}
+	if size := block.Size(); size > MaxBlockSize {
+		return fmt.Errorf("区块大小%d超过上限%d", size, MaxBlockSize)
+	}
+	sigOps := 0
+	for _, t := range block.Transactions {
+		if err := t.CheckSanity(); err != nil {
+			return fmt.Errorf("交易 %x 无效: %w", t.ID, err)
+		}
+		sigOps += t.SigOps()
+	}
+	if sigOps > MaxBlockSigOps {
+		return fmt.Errorf("区块签名检查次数%d超过上限%d", sigOps, MaxBlockSigOps)
+	}
+	return nil
+}
+
+// 拒绝与链上已有交易ID相同的交易，否则其输出会覆盖未花费输出集合中的同名输出
+// 旧区块被裁剪后交易索引不再完整，此时还要检查该交易ID是否仍有未花费的输出
+func (bc *Blockchain) checkDuplicateTx(t *tx.Transaction) error {
+	_, err := bc.store.GetIndex(txIndex, t.ID)
+	if err == nil {
+		return fmt.Errorf("交易 %x 与链上已有的交易重复", t.ID)
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	for idx := range t.Outputs {
+		if _, ok := bc.utxos[outpointKey(t.ID, idx)]; ok {
+			return fmt.Errorf("交易 %x 与链上未花费的交易重复", t.ID)
+		}
+	}
+	return nil
+}
+
+// 交易列表存在重复形式：与另一个交易列表的Merkle根相同（CVE-2012-2459）
+var ErrMutatedMerkle = errors.New("交易列表含有重复的Merkle节点（CVE-2012-2459）")
+
+// 按区块版本检查Merkle根，拒绝存在重复形式的交易列表
+func checkMerkleRoot(block *pow.Block) error {
+	root, mutated := block.ComputeMerkleRoot()
+	if mutated {
+		return ErrMutatedMerkle
+	}
+	if root != block.MerkleRoot {
+		return errors.New("Merkle根与交易不符")
+	}
+	return nil
+}
+
+// 未花费输出及其所在区块的高度与时间（用于相对时间锁与Coinbase成熟度）
+type utxoEntry struct {
+	tx.TXOutput
+	Height   int
+	Time     uint32
+	Coinbase bool
+}
+
+// 未花费输出视图，键为outpointKey，与数据库中utxo索引的键相同
+type utxoView map[string]utxoEntry
+
+// 当前所有未花费输出的副本，调用方需持有读锁
+func (bc *Blockchain) utxoView() utxoView {
+	return maps.Clone(bc.utxos)
+}
+
+// 应用一组位于给定高度、时间的区块中的交易：移除被花费的输出，加入新输出
+func (v utxoView) connect(txs []*tx.Transaction, height int, blockTime uint32) {
+	for _, t := range txs {
+		if !t.IsCoinbase() {
+			for _, vin := range t.Inputs {
+				delete(v, outpointKey(vin.Txid, vin.Vout))
+			}
+		}
+		for idx, out := range t.Outputs {
+			v[outpointKey(t.ID, idx)] = utxoEntry{TXOutput: out, Height: height, Time: blockTime, Coinbase: t.IsCoinbase()}
+		}
+	}
+}
+
+// 检查交易能否进入给定高度的区块：绝对时间锁与各输入的相对时间锁
+// lockTime为该区块之前的中位时间（MTP），不使用区块自身的时间戳
+func (v utxoView) checkLocks(t *tx.Transaction, height int, lockTime uint32) error {
+	if !t.IsFinal(height, lockTime) {
+		return fmt.Errorf("交易锁定至%d，尚未生效", t.LockTime)
+	}
+	for idx, vin := range t.Inputs {
+		blocks, seconds, ok := t.RelativeLock(idx)
+		if !ok {
+			continue
+		}
+		prev, ok := v[outpointKey(vin.Txid, vin.Vout)]
+		if !ok {
+			continue // 输入是否存在由checkTx检查
+		}
+		if height < prev.Height+blocks || int64(lockTime) < int64(prev.Time)+seconds {
+			return fmt.Errorf("输入 %x:%d 的相对时间锁尚未到期", vin.Txid, vin.Vout)
+		}
+	}
+	return nil
+}
+
+// 检查交易花费的Coinbase输出在给定高度是否已成熟：须经过maturity个区块
+func (v utxoView) checkMaturity(t *tx.Transaction, height, maturity int) error {
+	for _, vin := range t.Inputs {
+		prev, ok := v[outpointKey(vin.Txid, vin.Vout)]
+		if !ok || !prev.Coinbase {
+			continue
+		}
+		if depth := height - prev.Height; depth < maturity {
+			return fmt.Errorf("输入 %x:%d 花费的Coinbase输出尚未成熟（%d/%d）", vin.Txid, vin.Vout, depth, maturity)
+		}
+	}
+	return nil
+}
+
+// 检查普通交易能否在视图上执行，返回手续费
+func (v utxoView) checkTx(t *tx.Transaction) (tx.Amount, error) {
+	if t.IsCoinbase() {
+		return 0, errors.New("Coinbase交易只能位于区块第一笔")
+	}
+	if !bytes.Equal(t.CalcID(), t.ID) {
+		return 0, errors.New("交易ID与内容不符")
+	}
+	if !t.VerifyTransaction() {
+		return 0, errors.New("交易签名无效")
+	}
+	if err := t.CheckSanity(); err != nil {
+		return 0, err
+	}
+	var in, out tx.Amount
+	for _, vin := range t.Inputs {
+		key := outpointKey(vin.Txid, vin.Vout)
+		prev, ok := v[key]
+		if !ok {
+			return 0, fmt.Errorf("输入 %x:%d 不存在或已被花费", vin.Txid, vin.Vout)
+		}
+		// 签名只证明持有该公钥，还需确认被花费的输出属于该公钥
+		if !bytes.Equal(prev.PubKeyHash, wallet.HashPubKey(vin.PubKey)) {
+			return 0, fmt.Errorf("输入 %x:%d 的公钥与输出所有者不符", vin.Txid, vin.Vout)
+		}
+		var err error
+		if in, err = in.Add(prev.Value); err != nil {
+			return 0, errors.New("输入总额超出允许范围")
+		}
+	}
+	// 输出金额的范围已由CheckSanity保证
+	for _, o := range t.Outputs {
+		out += o.Value
+	}
+	if in < out {
+		return 0, errors.New("输出总额大于输入总额")
+	}
+	return in - out, nil
+}
+
+// 完整校验一个待接入链尾的区块，调用方需持有写锁
+func (bc *Blockchain) validateBlock(block *pow.Block) error {
+	if block.PreviousHash != bc.tipHash() {
+		return ErrStaleTip
+	}
+	if block.Bits != bc.Net.Bits {
+		return errors.New("区块难度值不正确")
+	}
+	hash := block.CalculateHash()
+	target := pow.BitsToTarget(block.Bits)
+	if bytes.Compare(hash[:], target[:]) > 0 {
+		return errors.New("区块哈希不满足难度要求")
+	}
+	if err := bc.checkTimestamp(block); err != nil {
+		return err
+	}
+	if err := checkBlockSanity(block); err != nil {
+		return err
+	}
+	if !block.Transactions[0].IsCoinbase() {
+		return errors.New("区块第一笔交易必须是Coinbase")
+	}
+	if block.Version != bc.Net.BlockVersion() {
+		return fmt.Errorf("区块版本%d不正确，应为%d", block.Version, bc.Net.BlockVersion())
+	}
+	if err := checkMerkleRoot(block); err != nil {
+		return err
+	}
+
+	// 依次执行交易，同一区块内可以花费前面交易的输出
+	height, mtp := len(bc.Blocks), bc.medianTimePast()
+	view := bc.utxoView()
+	seen := make(map[string]bool)
+	var fees tx.Amount
+	for i, t := range block.Transactions {
+		if seen[string(t.ID)] {
+			return fmt.Errorf("交易 %x 重复", t.ID)
+		}
+		seen[string(t.ID)] = true
+		if err := bc.checkDuplicateTx(t); err != nil {
+			return err
+		}
+		if i == 0 && !bytes.Equal(t.CalcID(), t.ID) {
+			return errors.New("Coinbase交易ID与内容不符")
+		}
+		if err := view.checkLocks(t, height, mtp); err != nil {
+			return fmt.Errorf("交易 %x 无效: %w", t.ID, err)
+		}
+		if err := view.checkMaturity(t, height, bc.Net.CoinbaseMaturity); err != nil {
+			return fmt.Errorf("交易 %x 无效: %w", t.ID, err)
+		}
+		if i > 0 {
+			fee, err := view.checkTx(t)
+			if err != nil {
+				return fmt.Errorf("交易 %x 无效: %w", t.ID, err)
+			}
+			if fees, err = fees.Add(fee); err != nil {
+				return errors.New("手续费总额超出允许范围")
+			}
+		}
+		view.connect([]*tx.Transaction{t}, height, block.Timestamp)
+	}
+
+	var coinbaseValue tx.Amount
+	for _, out := range block.Transactions[0].Outputs {
+		coinbaseValue += out.Value
+	}
+	if coinbaseValue > tx.BlockSubsidy+fees {
+		return fmt.Errorf("Coinbase金额%s超过奖励与手续费之和%s", coinbaseValue, tx.BlockSubsidy+fees)
+	}
+	return nil
+}
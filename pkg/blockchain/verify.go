@@ -0,0 +1,163 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 链校验级别，每一级包含之前各级的检查
+const (
+	VerifyHeaders    = iota // 区块哈希、难度与前后连接
+	VerifyMerkle            // 区块结构与Merkle根
+	VerifySignatures        // 交易ID与签名
+	VerifyUTXO              // 从创世块重新执行所有区块，结果与数据库中的未花费输出集合、交易索引一致
+)
+
+// 校验发现的第一个有问题的区块
+type VerifyError struct {
+	Height int
+	Hash   [32]byte
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("区块 #%d (%x): %v", e.Height, e.Hash, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// 按给定级别重新检查数据库中存储的区块链，返回第一个有问题的区块（*VerifyError）
+// 区块从数据库重新读取，而不是使用内存中的副本；已裁剪的区块只检查区块头，
+// 有区块被裁剪时无法执行VerifyUTXO级别的检查
+// 校验期间持有读锁，新区块要等校验结束后才能接入
+func (bc *Blockchain) VerifyChain(level int) error {
+	if level < VerifyHeaders || level > VerifyUTXO {
+		return fmt.Errorf("校验级别须在%d-%d之间", VerifyHeaders, VerifyUTXO)
+	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if level >= VerifyUTXO && bc.pruned > 0 {
+		return fmt.Errorf("重新执行需要完整的区块，区块 #0-#%d: %w", bc.pruned-1, ErrPruned)
+	}
+
+	var replay *Blockchain
+	if level >= VerifyUTXO {
+		var err error
+		if replay, err = NewBlockchainWithStore(db.NewMemStore(), bc.Net); err != nil {
+			return err
+		}
+		defer replay.Close()
+	}
+	var prev [32]byte
+	for height, block := range bc.Blocks {
+		hash := block.CalculateHash()
+		stored, err := bc.verifyBlock(height, hash, prev, level)
+		if err != nil {
+			return &VerifyError{height, hash, err}
+		}
+		if replay != nil && height > 0 {
+			if _, err := replay.importBlock(height, stored); err != nil {
+				return &VerifyError{height, hash, err}
+			}
+		}
+		prev = hash
+	}
+	if replay != nil {
+		return bc.verifyIndexes(replay)
+	}
+	return nil
+}
+
+// 从数据库读取并检查单个区块，返回读到的区块
+func (bc *Blockchain) verifyBlock(height int, hash, prev [32]byte, level int) (*pow.Block, error) {
+	block, err := bc.store.GetBlock(hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("读取区块失败: %w", err)
+	}
+	if block.CalculateHash() != hash {
+		return nil, errors.New("区块内容与哈希不符")
+	}
+	if block.PreviousHash != prev {
+		return nil, errors.New("前一区块哈希与链不符")
+	}
+	if block.Version != bc.Net.BlockVersion() {
+		return nil, fmt.Errorf("区块版本%d不正确，应为%d", block.Version, bc.Net.BlockVersion())
+	}
+	if height == 0 {
+		if hash != bc.Net.GenesisHash {
+			return nil, fmt.Errorf("创世块与%s网络不符", bc.Net.Name)
+		}
+	} else {
+		if block.Bits != bc.Net.Bits {
+			return nil, errors.New("区块难度值不正确")
+		}
+		target := pow.BitsToTarget(block.Bits)
+		if bytes.Compare(hash[:], target[:]) > 0 {
+			return nil, errors.New("区块哈希不满足难度要求")
+		}
+	}
+	if level < VerifyMerkle || height < bc.pruned {
+		return block, nil
+	}
+
+	if err := checkBlockSanity(block); err != nil {
+		return nil, err
+	}
+	if err := checkMerkleRoot(block); err != nil {
+		return nil, err
+	}
+	if level < VerifySignatures {
+		return block, nil
+	}
+	for _, t := range block.Transactions {
+		if !bytes.Equal(t.CalcID(), t.ID) {
+			return nil, fmt.Errorf("交易 %x 的ID与内容不符", t.ID)
+		}
+		if !t.VerifyTransaction() {
+			return nil, fmt.Errorf("交易 %x 的签名无效", t.ID)
+		}
+	}
+	return block, nil
+}
+
+// 比较重新执行得到的未花费输出与交易索引和数据库中的记录
+func (bc *Blockchain) verifyIndexes(replay *Blockchain) error {
+	want := replay.utxoView()
+	err := bc.store.ForEachIndex(utxoIndex, func(key, value []byte) error {
+		e, ok := want[string(key)]
+		if !ok {
+			return fmt.Errorf("未花费输出集合中多出 %x", key)
+		}
+		if !bytes.Equal(value, encodeUTXOEntry(e)) {
+			return fmt.Errorf("未花费输出 %x 与区块不符", key)
+		}
+		delete(want, string(key))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for key := range want {
+		return fmt.Errorf("未花费输出集合中缺少 %x", key)
+	}
+
+	for height, block := range bc.Blocks {
+		hash := block.CalculateHash()
+		for _, t := range block.Transactions {
+			data, err := bc.store.GetIndex(txIndex, t.ID)
+			if err != nil {
+				return &VerifyError{height, hash, fmt.Errorf("交易 %x 的索引: %w", t.ID, err)}
+			}
+			if !bytes.Equal(data, hash[:]) {
+				return &VerifyError{height, hash, fmt.Errorf("交易 %x 的索引指向区块 %x", t.ID, data)}
+			}
+		}
+	}
+	return nil
+}
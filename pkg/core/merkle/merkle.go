@@ -1,10 +1,9 @@
 package merkle
 
 import (
-	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
 	"fmt"
+	"slices"
 
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
 )
@@ -17,23 +16,67 @@ type MerkleNode struct {
 	RightChild *MerkleNode
 }
 
-// 从数据块构建Merkle树，返回根
-func CreateTree(datas []*tx.Transaction) MerkleNode {
+// Merkle根的计算方式
+type Mode int
+
+const (
+	// 叶节点为交易序列化结果的SHA-256，父节点为子节点哈希拼接后的SHA-256，
+	// 某层节点数为奇数时末尾节点单独计算哈希
+	Legacy Mode = iota
+	// 与比特币一致：叶节点为交易序列化结果的双SHA-256，父节点为子节点哈希拼接后的双SHA-256，
+	// 某层节点数为奇数时复制末尾节点与自身配对
+	// 叶节点的算法与比特币的交易ID相同；本项目的交易ID不含签名，不能直接作为叶节点，否则Merkle根不承诺签名
+	Bitcoin
+)
+
+// 计算交易列表的Merkle根，只保存各层哈希，不构建节点树；mode缺省为Legacy
+// 空交易列表的根为全零哈希。mutated的含义见BitcoinRoot，Legacy方式下恒为false
+func Root(datas []*tx.Transaction, mode ...Mode) (root [32]byte, mutated bool) {
+	m := Legacy
+	if len(mode) > 0 {
+		m = mode[0]
+	}
+	leaves := make([][32]byte, len(datas))
+	for i, data := range datas {
+		if m == Bitcoin {
+			leaves[i] = BitcoinLeaf(data)
+		} else {
+			leaves[i] = sha256.Sum256(data.Serialize())
+		}
+	}
+	return reduce(leaves, m)
+}
+
+// 从数据块构建Merkle树，返回根；mode缺省为Legacy
+// 树中每个叶节点都引用其交易，只在需要打印或生成证明时使用，只需要根时使用Root
+// 空交易列表返回哈希为全零的空节点
+func CreateTree(datas []*tx.Transaction, mode ...Mode) MerkleNode {
+	m := Legacy
+	if len(mode) > 0 {
+		m = mode[0]
+	}
+	if len(datas) == 0 {
+		return MerkleNode{}
+	}
 	var nodes []MerkleNode
 	// 遍历所有数据块，创建叶节点
 	for _, data := range datas {
 		var newNode MerkleNode
 
 		newNode.Data = data
-		updateHash(&newNode)
+		updateHash(&newNode, m)
 
 		nodes = append(nodes, newNode)
 	}
-	return buildTree(nodes)[0]
+	if m == Bitcoin && len(nodes) == 1 {
+		// 比特币中只有一笔交易时根即为该交易的叶节点哈希
+		return nodes[0]
+	}
+	return buildTree(nodes, m)[0]
 }
 
 // 递归逐层构建Merkle树
-func buildTree(sons []MerkleNode) []MerkleNode {
+func buildTree(sons []MerkleNode, mode Mode) []MerkleNode {
 	var fathers []MerkleNode
 	// 相邻节点配对，创建它们的父节点
 	for i := 0; i < len(sons); i += 2 {
@@ -42,8 +85,10 @@ func buildTree(sons []MerkleNode) []MerkleNode {
 		newNode.LeftChild = &sons[i]
 		if i+1 < len(sons) {
 			newNode.RightChild = &sons[i+1]
+		} else if mode == Bitcoin {
+			newNode.RightChild = &sons[i]
 		}
-		updateHash(&newNode)
+		updateHash(&newNode, mode)
 
 		fathers = append(fathers, newNode)
 	}
@@ -51,10 +96,64 @@ func buildTree(sons []MerkleNode) []MerkleNode {
 	if len(fathers) == 1 {
 		return fathers
 	} else {
-		return buildTree(fathers)
+		return buildTree(fathers, mode)
 	}
 }
 
+// 比特币方式下交易的叶节点哈希：含签名的序列化结果的双SHA-256
+func BitcoinLeaf(t *tx.Transaction) [32]byte {
+	hash := sha256.Sum256(t.Serialize())
+	return sha256.Sum256(hash[:])
+}
+
+// 按比特币的方式由叶节点哈希计算Merkle根
+// 比特币中交易ID按内部字节序参与计算，与区块浏览器中显示的顺序相反
+//
+// 复制末尾节点使得交易列表[a b c]与[a b c c]的根相同（CVE-2012-2459），
+// 因此某层出现相邻配对的两个节点哈希相同时mutated为true，此时应拒绝该交易列表
+func BitcoinRoot(hashes [][32]byte) (root [32]byte, mutated bool) {
+	return reduce(slices.Clone(hashes), Bitcoin)
+}
+
+// 在leaves上逐层原地计算父节点哈希，返回根；空列表的根为全零哈希
+// Legacy方式下即使只有一个节点也要计算一层，与CreateTree一致
+func reduce(level [][32]byte, mode Mode) (root [32]byte, mutated bool) {
+	if len(level) == 0 {
+		return root, false
+	}
+	for first := true; len(level) > 1 || (first && mode != Bitcoin); first = false {
+		n := 0
+		for i := 0; i < len(level); i += 2 {
+			switch {
+			case i+1 < len(level):
+				if mode == Bitcoin && level[i] == level[i+1] {
+					mutated = true
+				}
+				level[n] = hashPair(level[i], level[i+1], mode)
+			case mode == Bitcoin:
+				level[n] = hashPair(level[i], level[i], mode)
+			default:
+				level[n] = sha256.Sum256(level[i][:])
+			}
+			n++
+		}
+		level = level[:n]
+	}
+	return level[0], mutated
+}
+
+// 父节点哈希：Legacy为拼接后的SHA-256，Bitcoin为拼接后的双SHA-256
+func hashPair(left, right [32]byte, mode Mode) [32]byte {
+	var buf [64]byte
+	copy(buf[:32], left[:])
+	copy(buf[32:], right[:])
+	hash := sha256.Sum256(buf[:])
+	if mode == Bitcoin {
+		hash = sha256.Sum256(hash[:])
+	}
+	return hash
+}
+
 // 递归打印各节点的哈希值
 func PrintTree(now MerkleNode, layer int) {
 	for range layer {
@@ -75,21 +174,22 @@ func PrintTree(now MerkleNode, layer int) {
 }
 
 // 根据子节点信息，计算当前节点Hash
-func updateHash(node *MerkleNode) {
+func updateHash(node *MerkleNode, mode Mode) {
+	if mode == Bitcoin {
+		if node.Data != nil {
+			node.Hash = BitcoinLeaf(node.Data)
+		} else {
+			node.Hash = hashPair(node.LeftChild.Hash, node.RightChild.Hash, mode)
+		}
+		return
+	}
 	hash := sha256.New()
 
 	// 存在data，说明是叶节点
 	// 否则根据左右子节点的哈希计算
 	if node.Data != nil {
-		// 若指向数据块，使用gob序列化并计算哈希值
-		var serializedData []byte
-		buffer := bytes.NewBuffer(serializedData)
-		encoder := gob.NewEncoder(buffer)
-		err := encoder.Encode(node.Data)
-		if err != nil {
-			panic(fmt.Sprintf("Failed to serialize data: %v", err))
-		}
-		hash.Write(buffer.Bytes())
+		// 若指向数据块，对交易的确定性序列化结果计算哈希值
+		hash.Write(node.Data.Serialize())
 	} else {
 		hash.Write(node.LeftChild.Hash[:])
 		if node.RightChild != nil {
@@ -1,9 +1,11 @@
 package pow
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -23,19 +25,27 @@ type Block struct {
 	Transactions []*tx.Transaction
 }
 
+// 默认难度值
+var DefaultBits = [4]byte{0x1f, 0x00, 0xff, 0xff}
+
+// 区块版本，决定Merkle根的计算方式
+const (
+	BlockVersion              = 2 // merkle.Legacy
+	BlockVersionBitcoinMerkle = 3 // merkle.Bitcoin，与比特币兼容
+)
+
 func NewBlock(previousHash [32]byte, transactions []*tx.Transaction, bits ...[4]byte) Block {
 	var newBlock Block
 
-	newBlock.Version = 2
+	newBlock.Version = BlockVersion
 	newBlock.PreviousHash = previousHash
-	merkleRoot := merkle.CreateTree(transactions)
-	newBlock.MerkleRoot = merkleRoot.Hash
+	newBlock.MerkleRoot, _ = merkle.Root(transactions)
 
 	newBlock.Timestamp = uint32(time.Now().Unix())
 	if len(bits) > 0 {
 		newBlock.Bits = bits[0]
 	} else {
-		newBlock.Bits = [4]byte{0x1f, 0x00, 0xff, 0xff}
+		newBlock.Bits = DefaultBits
 	}
 	newBlock.Nounce = 0
 
@@ -45,17 +55,104 @@ func NewBlock(previousHash [32]byte, transactions []*tx.Transaction, bits ...[4]
 }
 
 func (block *Block) CalculateHash() [32]byte {
-	hash := sha256.New()
+	return sha256.Sum256(block.serializeHeader())
+}
 
-	// 数值型和字节数组采用不同的方式写入
-	binary.Write(hash, binary.BigEndian, block.Version)
-	hash.Write(block.PreviousHash[:])
-	hash.Write(block.MerkleRoot[:])
-	binary.Write(hash, binary.BigEndian, block.Timestamp)
-	hash.Write(block.Bits[:])
-	binary.Write(hash, binary.BigEndian, block.Nounce)
+// 区块版本对应的Merkle根计算方式
+func (block *Block) MerkleMode() merkle.Mode {
+	if block.Version >= BlockVersionBitcoinMerkle {
+		return merkle.Bitcoin
+	}
+	return merkle.Legacy
+}
 
-	return [32]byte(hash.Sum(nil))
+// 按区块版本计算交易列表的Merkle根
+// mutated为true表示交易列表存在比特币方式下根相同的重复形式（CVE-2012-2459），区块应被拒绝
+func (block *Block) ComputeMerkleRoot() (root [32]byte, mutated bool) {
+	return merkle.Root(block.Transactions, block.MerkleMode())
+}
+
+// 修改区块版本并重新计算Merkle根
+func (block *Block) SetVersion(version uint32) {
+	block.Version = version
+	block.MerkleRoot, _ = block.ComputeMerkleRoot()
+}
+
+// 只含区块头的副本，区块内容被裁剪后用于保留链结构
+func (block *Block) Header() *Block {
+	header := *block
+	header.Transactions = nil
+	return &header
+}
+
+// 区块头序列化结果的长度
+const headerSize = 4 + 32 + 32 + 4 + 4 + 4
+
+// 区块大小：区块头加上所有交易序列化后的字节数
+func (block *Block) Size() int {
+	size := headerSize
+	for _, t := range block.Transactions {
+		size += t.Size()
+	}
+	return size
+}
+
+// 序列化区块头，数值型统一采用大端序
+func (block *Block) serializeHeader() []byte {
+	buf := make([]byte, 0, headerSize)
+	buf = binary.BigEndian.AppendUint32(buf, block.Version)
+	buf = append(buf, block.PreviousHash[:]...)
+	buf = append(buf, block.MerkleRoot[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, block.Timestamp)
+	buf = append(buf, block.Bits[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, block.Nounce)
+	return buf
+}
+
+// 序列化整个区块：区块头、4字节交易数，之后每笔交易为4字节长度加tx.Serialize的结果
+func (block *Block) Serialize() []byte {
+	buf := block.serializeHeader()
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(block.Transactions)))
+	for _, t := range block.Transactions {
+		data := t.Serialize()
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+// 从Serialize的结果还原区块
+func DeserializeBlock(data []byte) (*Block, error) {
+	if len(data) < headerSize+4 {
+		return nil, errors.New("区块数据长度不足")
+	}
+	block := &Block{Version: binary.BigEndian.Uint32(data)}
+	copy(block.PreviousHash[:], data[4:36])
+	copy(block.MerkleRoot[:], data[36:68])
+	block.Timestamp = binary.BigEndian.Uint32(data[68:])
+	copy(block.Bits[:], data[72:76])
+	block.Nounce = binary.BigEndian.Uint32(data[76:])
+	n := binary.BigEndian.Uint32(data[headerSize:])
+	data = data[headerSize+4:]
+	for i := uint32(0); i < n; i++ {
+		if len(data) < 4 {
+			return nil, errors.New("区块数据长度不足")
+		}
+		size := binary.BigEndian.Uint32(data)
+		if uint64(size) > uint64(len(data)-4) {
+			return nil, errors.New("区块数据长度不足")
+		}
+		t, err := tx.DeserializeTransaction(data[4 : 4+size])
+		if err != nil {
+			return nil, fmt.Errorf("交易#%d: %w", i, err)
+		}
+		block.Transactions = append(block.Transactions, t)
+		data = data[4+size:]
+	}
+	if len(data) != 0 {
+		return nil, errors.New("区块数据末尾有多余字节")
+	}
+	return block, nil
 }
 
 // 将bits转换为难度目标值Target
@@ -72,19 +169,8 @@ func BitsToTarget(bits [4]byte) [32]byte {
 	return targetBytes
 }
 
+// 挖掘区块，返回满足难度要求的区块哈希
 func (block *Block) MineBlock() [32]byte {
-	target := BitsToTarget(block.Bits)
-
-	// bytes.Compare(target1, target2)用于比较字典序
-	// 若 target1<target2 返回-1，否则返回1
-	for hash := block.CalculateHash(); bytes.Compare(hash[:], target[:]) > 0; {
-		block.Nounce++
-		block.Timestamp = uint32(time.Now().Unix())
-
-		hash = block.CalculateHash()
-		// if block.nounce%1000 == 0 {
-		// 	fmt.Printf("Current hash: %x\n", hash)
-		// }
-	}
-	return block.CalculateHash()
+	hash, _, _ := block.Mine(context.Background())
+	return hash
 }
@@ -0,0 +1,133 @@
+package pow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 挖矿统计信息
+type MineStats struct {
+	Hashes  uint64        // 计算的哈希次数
+	Elapsed time.Duration // 耗时
+	Rounds  int           // 遍历的nonce空间轮数，每轮结束后滚动时间戳或额外nonce
+}
+
+// 平均算力（次/秒）
+func (s MineStats) HashRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Hashes) / s.Elapsed.Seconds()
+}
+
+// 每计算这么多次哈希检查一次是否需要停止
+const checkInterval = 1 << 12
+
+// 并行挖矿：将32位nonce空间均分给多个协程，找到解或ctx被取消时返回
+// workers 缺省为 runtime.NumCPU()
+// nonce空间用尽时滚动时间戳，时间戳无法前进时改写Coinbase中的额外nonce并重算Merkle根
+func (block *Block) Mine(ctx context.Context, workers ...int) ([32]byte, MineStats, error) {
+	n := runtime.NumCPU()
+	if len(workers) > 0 && workers[0] > 0 {
+		n = workers[0]
+	}
+	target := BitsToTarget(block.Bits)
+	start := time.Now()
+	var stats MineStats
+
+	for {
+		stats.Rounds++
+		nonce, found, hashes := searchNonce(ctx, block.serializeHeader(), target, n)
+		stats.Hashes += hashes
+		if found {
+			block.Nounce = nonce
+			stats.Elapsed = time.Since(start)
+			return block.CalculateHash(), stats, nil
+		}
+		if err := ctx.Err(); err != nil {
+			stats.Elapsed = time.Since(start)
+			return [32]byte{}, stats, err
+		}
+		block.rollHeader()
+	}
+}
+
+// nonce空间用尽后调整区块头，使下一轮得到不同的哈希
+func (block *Block) rollHeader() {
+	now := uint32(time.Now().Unix())
+	switch {
+	case now > block.Timestamp:
+		block.Timestamp = now
+	case len(block.Transactions) > 0 && block.Transactions[0].IsCoinbase():
+		block.incrementExtraNonce()
+	default:
+		// 没有Coinbase可改写时只能让时间戳略微超前
+		block.Timestamp++
+	}
+}
+
+// 额外nonce存放在Coinbase输入的Signature字段（Coinbase不需要签名）
+func (block *Block) incrementExtraNonce() {
+	coinbase := *block.Transactions[0]
+	coinbase.Inputs = slices.Clone(coinbase.Inputs)
+	var extraNonce uint64
+	if sig := coinbase.Inputs[0].Signature; len(sig) == 8 {
+		extraNonce = binary.BigEndian.Uint64(sig)
+	}
+	coinbase.Inputs[0].Signature = binary.BigEndian.AppendUint64(nil, extraNonce+1)
+	coinbase.ID = coinbase.CalcID()
+
+	// 交易列表可能与调用方共享，复制后再替换Coinbase
+	block.Transactions = slices.Clone(block.Transactions)
+	block.Transactions[0] = &coinbase
+	block.MerkleRoot, _ = block.ComputeMerkleRoot()
+}
+
+// 在整个nonce空间中并行搜索满足目标值的nonce
+func searchNonce(ctx context.Context, header []byte, target [32]byte, workers int) (uint32, bool, uint64) {
+	var (
+		found   atomic.Bool
+		result  atomic.Uint32
+		hashes  atomic.Uint64
+		wg      sync.WaitGroup
+		space   = uint64(math.MaxUint32) + 1
+		perPart = (space + uint64(workers) - 1) / uint64(workers)
+	)
+	for i := range workers {
+		from := uint64(i) * perPart
+		to := min(from+perPart, space)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := slices.Clone(header)
+			nonceBytes := buf[headerSize-4:]
+			var count uint64
+			defer func() { hashes.Add(count) }()
+			for nonce := from; nonce < to; nonce++ {
+				if count%checkInterval == 0 && (found.Load() || ctx.Err() != nil) {
+					return
+				}
+				binary.BigEndian.PutUint32(nonceBytes, uint32(nonce))
+				hash := sha256.Sum256(buf)
+				count++
+				// bytes.Compare 比较字典序，哈希不大于目标值即满足难度
+				if bytes.Compare(hash[:], target[:]) <= 0 {
+					if found.CompareAndSwap(false, true) {
+						result.Store(uint32(nonce))
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return result.Load(), found.Load(), hashes.Load()
+}
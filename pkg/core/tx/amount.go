@@ -0,0 +1,104 @@
+package tx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 金额，以最小单位“分”计数，避免浮点误差，也不受平台int位数影响
+type Amount int64
+
+// 金额单位
+const (
+	Cent Amount = 1          // 最小单位
+	Coin Amount = 100 * Cent // 1个币
+)
+
+// 金额的小数位数
+const amountDecimals = 2
+
+var ErrAmountRange = errors.New("金额超出允许范围")
+
+// 解析十进制金额字符串，如"12"、"12.3"、"12.34"，最多两位小数
+func ParseAmount(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	if neg {
+		str = str[1:]
+	}
+	whole, frac, hasDot := strings.Cut(str, ".")
+	if !isDigits(whole) || whole == "" || (hasDot && frac == "") || !isDigits(frac) {
+		return 0, fmt.Errorf("无效的金额: %q", s)
+	}
+	if len(frac) > amountDecimals {
+		return 0, fmt.Errorf("金额最多%d位小数: %q", amountDecimals, s)
+	}
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > int64(MaxMoney/Coin) {
+		return 0, ErrAmountRange
+	}
+	f, _ := strconv.ParseInt(frac+strings.Repeat("0", amountDecimals-len(frac)), 10, 64)
+	a := Amount(w)*Coin + Amount(f)
+	if !MoneyRange(a) {
+		return 0, ErrAmountRange
+	}
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+// 格式化为带两位小数的十进制字符串
+func (a Amount) String() string {
+	sign, u := "", uint64(a)
+	if a < 0 {
+		sign, u = "-", uint64(-a)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, u/uint64(Coin), amountDecimals, u%uint64(Coin))
+}
+
+// 检查范围的加法，两个加数与结果都须在[0, MaxMoney]内
+func (a Amount) Add(b Amount) (Amount, error) {
+	if !MoneyRange(a) || !MoneyRange(b) || a > MaxMoney-b {
+		return 0, ErrAmountRange
+	}
+	return a + b, nil
+}
+
+// 检查范围的减法，结果不能为负
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if !MoneyRange(a) || !MoneyRange(b) || a < b {
+		return 0, ErrAmountRange
+	}
+	return a - b, nil
+}
+
+// JSON中以十进制数字表示，如12.34
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	v, err := ParseAmount(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 按每1000字节perKB的费率计算size字节交易的手续费，向上取整
+func FeeForSize(perKB Amount, size int) Amount {
+	return (Amount(size)*perKB + 999) / 1000
+}
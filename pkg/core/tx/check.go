@@ -0,0 +1,75 @@
+package tx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 共识限制
+const (
+	MaxMoney            Amount = 21_000_000 * Coin // 任何金额（单个输出或总和）都不能超过该值
+	MaxTxSize                  = 1_000_000         // 交易序列化后的最大字节数
+	MinCoinbaseDataSize        = 2                 // Coinbase附带数据的长度范围
+	MaxCoinbaseDataSize        = 100
+)
+
+// 交易序列化后的字节数
+func (tx *Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+// 签名检查次数：每个非Coinbase输入需要验证一次签名
+func (tx *Transaction) SigOps() int {
+	if tx.IsCoinbase() {
+		return 0
+	}
+	return len(tx.Inputs)
+}
+
+// 判断金额是否在合法范围[0, MaxMoney]内
+func MoneyRange(value Amount) bool {
+	return value >= 0 && value <= MaxMoney
+}
+
+// 与链状态无关的交易检查：结构、大小、金额范围
+func (tx *Transaction) CheckSanity() error {
+	if len(tx.Inputs) == 0 {
+		return errors.New("交易没有输入")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("交易没有输出")
+	}
+	if size := tx.Size(); size > MaxTxSize {
+		return fmt.Errorf("交易大小%d超过上限%d", size, MaxTxSize)
+	}
+
+	var total Amount
+	for _, out := range tx.Outputs {
+		if !MoneyRange(out.Value) {
+			return fmt.Errorf("输出金额%s超出允许范围", out.Value)
+		}
+		var err error
+		if total, err = total.Add(out.Value); err != nil {
+			return errors.New("输出总额超出允许范围")
+		}
+	}
+
+	if tx.IsCoinbase() {
+		if n := len(tx.Inputs[0].PubKey); n < MinCoinbaseDataSize || n > MaxCoinbaseDataSize {
+			return fmt.Errorf("Coinbase数据长度%d不在[%d, %d]内", n, MinCoinbaseDataSize, MaxCoinbaseDataSize)
+		}
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		if len(in.Txid) == 0 || in.Vout < 0 {
+			return errors.New("普通交易不能引用空输出")
+		}
+		key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+		if seen[key] {
+			return errors.New("交易重复花费同一输出")
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package tx
+
+// 交易版本与时间锁
+// LockTime：绝对时间锁，小于LockTimeThreshold时表示区块高度，否则表示Unix时间戳
+// Sequence：输入的相对时间锁（交易版本>=2时生效），从被花费输出所在区块起算
+const (
+	TxVersion = 2 // 新建交易的版本号
+
+	LockTimeThreshold = 500_000_000 // LockTime小于该值时按区块高度解释
+
+	SequenceFinal               uint32 = 0xffffffff // 输入不启用任何时间锁
+	SequenceLockTimeDisableFlag uint32 = 1 << 31    // 置位时不启用相对时间锁
+	SequenceLockTimeTypeFlag    uint32 = 1 << 22    // 置位时相对时间锁按时间计算，否则按区块数
+	SequenceLockTimeMask        uint32 = 0x0000ffff // 相对时间锁的数值部分
+	SequenceLockTimeGranularity        = 9          // 按时间计算时，单位为2^9=512秒
+)
+
+// 判断交易在给定高度、时间的区块中是否已生效
+// LockTime为0或所有输入的Sequence都为SequenceFinal时，交易总是生效
+func (tx *Transaction) IsFinal(height int, blockTime uint32) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	limit := int64(blockTime)
+	if tx.LockTime < LockTimeThreshold {
+		limit = int64(height)
+	}
+	if int64(tx.LockTime) < limit {
+		return true
+	}
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return false
+		}
+	}
+	return true
+}
+
+// 输入的相对时间锁：按区块数时返回blocks，按时间时返回seconds
+// 交易版本低于2或输入未启用相对时间锁时ok为false
+func (tx *Transaction) RelativeLock(idx int) (blocks int, seconds int64, ok bool) {
+	seq := tx.Inputs[idx].Sequence
+	if tx.Version < 2 || tx.IsCoinbase() || seq&SequenceLockTimeDisableFlag != 0 {
+		return 0, 0, false
+	}
+	value := seq & SequenceLockTimeMask
+	if seq&SequenceLockTimeTypeFlag != 0 {
+		return 0, int64(value) << SequenceLockTimeGranularity, true
+	}
+	return int(value), 0, true
+}
+
+// 构造按区块数计算的相对时间锁Sequence
+func SequenceBlocks(blocks uint16) uint32 {
+	return uint32(blocks)
+}
+
+// 构造按时间计算的相对时间锁Sequence，秒数向上取整到512秒
+func SequenceSeconds(seconds uint32) uint32 {
+	units := (seconds + 1<<SequenceLockTimeGranularity - 1) >> SequenceLockTimeGranularity
+	if units > SequenceLockTimeMask {
+		units = SequenceLockTimeMask
+	}
+	return SequenceLockTimeTypeFlag | units
+}
+
+// 小于等于该值的Sequence表示交易可被替换（RBF）
+const SequenceMaxReplaceable uint32 = SequenceFinal - 2
+
+// 判断交易是否声明可被替换：任一输入的Sequence不大于SequenceMaxReplaceable
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence <= SequenceMaxReplaceable {
+			return true
+		}
+	}
+	return false
+}
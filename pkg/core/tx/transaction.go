@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/sha256"
-	"encoding/gob"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -17,42 +18,151 @@ type TXInput struct {
 	Vout      int    // 引用的Vout索引
 	Signature []byte // 用交易发起方的私钥签名，用于确定发起人确实拥有这笔钱
 	PubKey    []byte // 交易发起方的原始公钥（并非比特币地址）
+	Sequence  uint32 // 相对时间锁，SequenceFinal表示不锁定
 }
 type TXOutput struct {
-	Value      int    // 金额
+	Value      Amount // 金额
 	PubKeyHash []byte // 交易输出方地址，即交易完成后实际拥有这笔钱的一方
 }
 type Transaction struct {
-	ID      []byte
-	Inputs  []TXInput
-	Outputs []TXOutput
+	ID       []byte
+	Version  uint32
+	Inputs   []TXInput
+	Outputs  []TXOutput
+	LockTime uint32 // 绝对时间锁，0表示不锁定
 }
 
 // 计算交易ID(Hash)
+// 签名不参与计算（签名内容本身包含交易ID）；Coinbase没有签名，其Signature字段用作额外nonce，保留
 func (tx *Transaction) CalcID() []byte {
-	var hash [32]byte
 	txCopy := *tx
-	txCopy.ID = []byte{}
-	// 使用Gob库而非Json对交易进行序列化，效率更高
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(txCopy)
-	if err != nil {
-		panic(err)
-	}
-	hash = sha256.Sum256(buf.Bytes())
+	if !tx.IsCoinbase() {
+		txCopy.Inputs = make([]TXInput, len(tx.Inputs))
+		for i, in := range tx.Inputs {
+			in.Signature = nil
+			txCopy.Inputs[i] = in
+		}
+	}
+	hash := sha256.Sum256(txCopy.Serialize())
 	return hash[:]
 }
 
+// 将交易序列化为确定的字节序列（不含ID），用于计算交易ID与Merkle树
+// Gob的编码结果依赖进程内类型注册的先后顺序，不同进程可能得到不同字节，因此不用于哈希
+// 数值型统一采用大端序，变长字段前加4字节长度
+func (tx *Transaction) Serialize() []byte {
+	var buf []byte
+	writeBytes := func(b []byte) {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+		buf = append(buf, b...)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, tx.Version)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		writeBytes(in.Txid)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(int32(in.Vout)))
+		writeBytes(in.Signature)
+		writeBytes(in.PubKey)
+		buf = binary.BigEndian.AppendUint32(buf, in.Sequence)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(int64(out.Value)))
+		writeBytes(out.PubKeyHash)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, tx.LockTime)
+	return buf
+}
+
+// 从Serialize的结果还原交易，交易ID重新计算
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	r := decoder{data: data}
+	tx := &Transaction{Version: r.uint32()}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		var in TXInput
+		in.Txid = r.bytes()
+		in.Vout = int(int32(r.uint32()))
+		in.Signature = r.bytes()
+		in.PubKey = r.bytes()
+		in.Sequence = r.uint32()
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		var out TXOutput
+		out.Value = Amount(int64(r.uint64()))
+		out.PubKeyHash = r.bytes()
+		tx.Outputs = append(tx.Outputs, out)
+	}
+	tx.LockTime = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, errors.New("交易数据末尾有多余字节")
+	}
+	tx.ID = tx.CalcID()
+	return tx, nil
+}
+
+// 按Serialize的格式依次读取字段，数据不足时记录错误并返回零值
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = errors.New("交易数据长度不足")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if d.err == nil && uint64(n) > uint64(len(d.data)) {
+		d.err = errors.New("交易数据长度不足")
+		return nil
+	}
+	return bytes.Clone(d.next(int(n)))
+}
+
+// 每个区块的挖矿奖励
+const BlockSubsidy = 100 * Coin
+
 // 创建Coinbase交易
 // Coinbase交易由挖矿产生，不涉及到用户主动的交易操作，故不放置到utxo模块
 func NewCoinbaseTX(to, data string) *Transaction {
+	return NewCoinbaseTXWithValue(to, data, BlockSubsidy)
+}
+
+// 创建指定金额的Coinbase交易（挖矿奖励加上区块内交易的手续费）
+func NewCoinbaseTXWithValue(to, data string, value Amount) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
-	txin := TXInput{[]byte{}, -1, []byte{}, []byte(data)}
-	txout := TXOutput{100, wallet.GetPubKeyHashFromAddress(to)}
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}}
+	txin := TXInput{[]byte{}, -1, []byte{}, []byte(data), SequenceFinal}
+	txout := TXOutput{value, wallet.GetPubKeyHashFromAddress(to)}
+	tx := Transaction{nil, TxVersion, []TXInput{txin}, []TXOutput{txout}, 0}
 	tx.ID = tx.CalcID()
 	return &tx
 }
@@ -65,6 +175,9 @@ func (tx *Transaction) IsCoinbase() bool {
 // 输出交易细节
 func (tx *Transaction) PrintDetails() {
 	fmt.Printf("[Transaction ID: %x]\n", tx.ID)
+	if tx.LockTime != 0 {
+		fmt.Printf("  LockTime: %d\n", tx.LockTime)
+	}
 	if tx.IsCoinbase() {
 		fmt.Println("  Coinbase Transaction")
 		fmt.Printf("  %s\n", tx.Inputs[0].PubKey)
@@ -74,11 +187,14 @@ func (tx *Transaction) PrintDetails() {
 			fmt.Printf("    Txid: %x\n", in.Txid)
 			fmt.Printf("    Vout: %d\n", in.Vout)
 			fmt.Printf("    PubKey: %x\n", in.PubKey)
+			if in.Sequence != SequenceFinal {
+				fmt.Printf("    Sequence: %#x\n", in.Sequence)
+			}
 		}
 	}
 	fmt.Println("  Outputs:")
 	for _, out := range tx.Outputs {
-		fmt.Printf("    Value: %d\n", out.Value)
+		fmt.Printf("    Value: %s\n", out.Value)
 		fmt.Printf("    PubKeyHash: %x\n", out.PubKeyHash)
 	}
 }
@@ -1,12 +1,15 @@
 package wallet
 
 import (
-	// "bytes"
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
 
 	"github.com/btcsuite/btcutil/base58"
 	"golang.org/x/crypto/ripemd160"
@@ -23,6 +26,28 @@ func NewWallet() *Wallet {
 	return &Wallet{privKey, pubKey}
 }
 
+// 由十六进制私钥恢复钱包
+func NewWalletFromKey(key string) (*Wallet, error) {
+	d, err := hex.DecodeString(key)
+	curve := elliptic.P256()
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("私钥应为64位十六进制数")
+	}
+	privateKey := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	if privateKey.D.Sign() == 0 || privateKey.D.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("私钥超出曲线范围")
+	}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(d)
+	publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
+	return &Wallet{privateKey, publicKey}, nil
+}
+
+// 十六进制私钥，可用NewWalletFromKey恢复钱包
+func (w *Wallet) PrivateKeyHex() string {
+	return hex.EncodeToString(w.PrivateKey.D.FillBytes(make([]byte, 32)))
+}
+
 // 生成密钥对
 func generateKeyPair() (*ecdsa.PrivateKey, []byte) {
 	// 随机生成私钥
@@ -52,7 +77,11 @@ const version = byte(0x00)
 const addressChecksumLen = 4
 
 func (w *Wallet) GetAddress() string {
-	pubKeyHash := HashPubKey(w.PublicKey)
+	return GetAddressFromPubKeyHash(HashPubKey(w.PublicKey))
+}
+
+// 由公钥哈希还原钱包地址
+func GetAddressFromPubKeyHash(pubKeyHash []byte) string {
 	payload := append([]byte{version}, pubKeyHash...)
 
 	// 计算两次SHA256，并取前4字节作为校验和
@@ -82,3 +111,15 @@ func GetPubKeyHashFromAddress(address string) []byte {
 	pubKeyHash := payload[1:]
 	return pubKeyHash
 }
+
+// 校验钱包地址格式与校验和
+func ValidateAddress(address string) bool {
+	fullPayload := base58.Decode(address)
+	if len(fullPayload) != 1+ripemd160.Size+addressChecksumLen || fullPayload[0] != version {
+		return false
+	}
+	payload := fullPayload[:len(fullPayload)-addressChecksumLen]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return bytes.Equal(second[:addressChecksumLen], fullPayload[len(fullPayload)-addressChecksumLen:])
+}
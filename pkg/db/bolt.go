@@ -0,0 +1,94 @@
+package db
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/boltdb/bolt"
+)
+
+// 基于boltdb的持久化存储
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// 打开（或创建）bolt数据库文件
+// check在升级旧版本数据库之前以只读方式检查其内容（如所属网络），返回错误时不修改文件
+func Open(path string, check ...func(Store) error) (Store, error) {
+	database, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &boltBackend{db: database}
+	if err := migrate(b, check...); err != nil {
+		database.Close()
+		return nil, err
+	}
+	return kvStore{b}, nil
+}
+
+func (b *boltBackend) get(bucket, key []byte) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		if bkt == nil {
+			return ErrNotFound
+		}
+		v := bkt.Get(key)
+		if v == nil {
+			return ErrNotFound
+		}
+		// bolt返回的切片只在事务内有效
+		value = bytes.Clone(v)
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltBackend) forEach(bucket []byte, fn func(key, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			return fn(bytes.Clone(k), bytes.Clone(v))
+		})
+	})
+}
+
+// 在同一个bolt事务中执行全部写操作
+func (b *boltBackend) write(ops []op) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, o := range ops {
+			bkt, err := tx.CreateBucketIfNotExists(o.bucket)
+			if err != nil {
+				return err
+			}
+			if o.value == nil {
+				err = bkt.Delete(o.key)
+			} else {
+				err = bkt.Put(o.key, o.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 在只读事务中写出数据库文件，得到事务开始时的一致状态
+func (b *boltBackend) backup(w io.Writer) (int64, error) {
+	var n int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+func (b *boltBackend) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// 内存存储，不落盘，供测试与临时链使用
+type memBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte // 关闭后为nil
+}
+
+// 新建空的内存存储
+func NewMemStore() Store {
+	m := &memBackend{buckets: make(map[string]map[string][]byte)}
+	m.write([]op{versionOp(SchemaVersion)})
+	return kvStore{m}
+}
+
+func (m *memBackend) get(bucket, key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.buckets == nil {
+		return nil, ErrClosed
+	}
+	v, ok := m.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(v), nil
+}
+
+// 与bolt一致，按键的字节序遍历调用时的快照
+func (m *memBackend) forEach(bucket []byte, fn func(key, value []byte) error) error {
+	m.mu.RLock()
+	if m.buckets == nil {
+		m.mu.RUnlock()
+		return ErrClosed
+	}
+	bkt := m.buckets[string(bucket)]
+	snapshot := make(map[string][]byte, len(bkt))
+	for k, v := range bkt {
+		snapshot[k] = bytes.Clone(v)
+	}
+	m.mu.RUnlock()
+
+	keys := make([]string, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), snapshot[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 持有写锁期间一次性生效，读取方不会看到部分结果
+func (m *memBackend) write(ops []op) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets == nil {
+		return ErrClosed
+	}
+	for _, o := range ops {
+		bkt := m.buckets[string(o.bucket)]
+		if bkt == nil {
+			bkt = make(map[string][]byte)
+			m.buckets[string(o.bucket)] = bkt
+		}
+		if o.value == nil {
+			delete(bkt, string(o.key))
+		} else {
+			bkt[string(o.key)] = o.value
+		}
+	}
+	return nil
+}
+
+// 把当前内容写入临时bolt文件再输出，备份可用Open打开
+func (m *memBackend) backup(w io.Writer) (int64, error) {
+	m.mu.RLock()
+	if m.buckets == nil {
+		m.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	var ops []op
+	for bucket, bkt := range m.buckets {
+		for k, v := range bkt {
+			ops = append(ops, op{[]byte(bucket), []byte(k), v})
+		}
+	}
+	m.mu.RUnlock()
+
+	f, err := os.CreateTemp("", "memstore-*.db")
+	if err != nil {
+		return 0, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	database, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer database.Close()
+	b := &boltBackend{db: database}
+	if err := b.write(ops); err != nil {
+		return 0, err
+	}
+	return b.backup(w)
+}
+
+func (m *memBackend) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets = nil
+	return nil
+}
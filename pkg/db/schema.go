@@ -0,0 +1,138 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 当前程序使用的数据库结构版本
+// 修改存储桶布局或区块编码时递增，并在migrations中追加对应的升级步骤
+const SchemaVersion = 2
+
+// 数据库结构版本高于程序支持的版本
+var ErrUnsupportedVersion = errors.New("db: unsupported schema version")
+
+// 元数据键
+const (
+	VersionKey = "version" // 结构版本，4字节大端序
+	NetworkKey = "network" // 所属网络ID，4字节大端序，由区块链写入
+	tipKey     = "tip"     // 链尾区块哈希
+)
+
+// 升级步骤：把版本为to-1的数据库升级为to，返回需要执行的写操作
+// 写操作与新版本号在同一批次中提交，中途失败时数据库仍停留在旧版本
+type migration struct {
+	to   int
+	desc string
+	run  func(b backend) ([]op, error)
+}
+
+var migrations = []migration{
+	{to: 1, desc: "链尾哈希从blocks桶移至meta桶", run: moveTipToMeta},
+	{to: 2, desc: "创世块固定，交易ID与区块哈希按确定的二进制编码计算", run: checkFixedGenesis},
+}
+
+// 检查数据库结构版本，逐步升级旧版本数据库；空数据库直接标记为当前版本
+// 写入任何内容之前先以只读方式执行check，任一检查失败时数据库保持原样
+func migrate(b backend, check ...func(Store) error) error {
+	version, empty, err := schemaVersion(b)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: 数据库版本%d高于程序支持的%d，请升级程序", ErrUnsupportedVersion, version, SchemaVersion)
+	}
+	for _, c := range check {
+		if err := c(kvStore{readOnlyBackend{b, version}}); err != nil {
+			return err
+		}
+	}
+	if empty {
+		return b.write([]op{versionOp(SchemaVersion)})
+	}
+	for _, m := range migrations {
+		if m.to <= version {
+			continue
+		}
+		ops, err := m.run(b)
+		if err != nil {
+			return fmt.Errorf("升级数据库到版本%d（%s）失败: %w", m.to, m.desc, err)
+		}
+		if err := b.write(append(ops, versionOp(m.to))); err != nil {
+			return fmt.Errorf("升级数据库到版本%d（%s）失败: %w", m.to, m.desc, err)
+		}
+	}
+	return nil
+}
+
+// 读取结构版本，不修改数据库
+// 没有版本记录时：存有区块的是最初的版本0，否则为新建的空数据库（empty），按当前版本处理
+func schemaVersion(b backend) (version int, empty bool, err error) {
+	data, err := b.get(metaBucket, []byte(VersionKey))
+	if err == nil {
+		if len(data) != 4 {
+			return 0, false, fmt.Errorf("数据库版本记录无效: %x", data)
+		}
+		return int(binary.BigEndian.Uint32(data)), false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return 0, false, err
+	}
+	if _, err := b.get(blocksBucket, legacyLastHashKey); err == nil {
+		return 0, false, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return 0, false, err
+	}
+	return SchemaVersion, true, nil
+}
+
+// 升级前的数据库为只读
+var errReadOnly = errors.New("db: 数据库升级前为只读")
+
+// 升级前供检查使用的只读视图，按数据库原有的结构版本读取链尾哈希
+type readOnlyBackend struct {
+	backend
+	version int
+}
+
+func (r readOnlyBackend) get(bucket, key []byte) ([]byte, error) {
+	if r.version < 1 && bytes.Equal(bucket, metaBucket) && string(key) == tipKey {
+		return r.backend.get(blocksBucket, legacyLastHashKey)
+	}
+	return r.backend.get(bucket, key)
+}
+
+func (readOnlyBackend) write([]op) error {
+	return errReadOnly
+}
+
+func (readOnlyBackend) close() error {
+	return errReadOnly
+}
+
+func versionOp(version int) op {
+	return op{bucket: metaBucket, key: []byte(VersionKey), value: binary.BigEndian.AppendUint32(nil, uint32(version))}
+}
+
+// 版本0在blocks桶中以lastHash为键保存链尾哈希，与区块哈希混在一起
+var legacyLastHashKey = []byte("lastHash")
+
+// 版本1 -> 2：存储布局不变，无需改写
+// 创世块按启动时间生成的旧数据库无法升级，由Open的check在升级前拒绝（见blockchain.ErrLegacyDatabase）
+func checkFixedGenesis(b backend) ([]op, error) {
+	return nil, nil
+}
+
+// 版本0 -> 1：链尾哈希移至meta桶
+func moveTipToMeta(b backend) ([]op, error) {
+	tip, err := b.get(blocksBucket, legacyLastHashKey)
+	if err != nil {
+		return nil, err
+	}
+	return []op{
+		{bucket: metaBucket, key: []byte(tipKey), value: tip},
+		{bucket: blocksBucket, key: legacyLastHashKey},
+	}, nil
+}
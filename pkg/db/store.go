@@ -0,0 +1,176 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+func init() {
+	gob.Register(&pow.Block{})
+	gob.Register(&tx.Transaction{})
+}
+
+// 要查找的区块、元数据或索引项不存在
+var ErrNotFound = errors.New("db: not found")
+
+// 存储已关闭
+var ErrClosed = errors.New("db: closed")
+
+// 区块链存储：区块、元数据与索引
+// 读取时不存在返回ErrNotFound；所有写入通过Batch原子地提交
+// 打开时检查结构版本并升级旧数据库，见SchemaVersion
+type Store interface {
+	GetBlock(hash []byte) (*pow.Block, error)                          // 按哈希读取区块
+	GetTip() ([]byte, error)                                           // 链尾区块哈希
+	GetMeta(key string) ([]byte, error)                                // 读取元数据
+	GetIndex(index string, key []byte) ([]byte, error)                 // 读取索引项
+	ForEachIndex(index string, fn func(key, value []byte) error) error // 按键的字节序遍历索引，fn返回错误时停止，fn中不能写入
+	Write(b *Batch) error                                              // 原子地执行一批写入，失败时不产生任何修改
+	Backup(w io.Writer) (int64, error)                                 // 在一致的只读视图上写出完整的bolt数据库文件，不阻塞写入
+	Close() error
+}
+
+// 存储桶名
+var (
+	blocksBucket = []byte("blocks")
+	metaBucket   = []byte("meta")
+)
+
+// 索引存储桶名
+func indexBucket(index string) []byte {
+	return []byte("index/" + index)
+}
+
+// 单个写操作，value为nil时表示删除
+type op struct {
+	bucket, key, value []byte
+}
+
+// 一批写入，由Store.Write原子地提交
+// 编码失败的错误在提交时返回
+type Batch struct {
+	ops []op
+	err error
+}
+
+// 新建空的写入批次
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// 写入区块
+func (b *Batch) PutBlock(hash []byte, block *pow.Block) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(block); err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	b.put(blocksBucket, hash, buf.Bytes())
+}
+
+// 删除区块
+func (b *Batch) DeleteBlock(hash []byte) {
+	b.put(blocksBucket, hash, nil)
+}
+
+// 设置链尾区块哈希
+func (b *Batch) SetTip(hash []byte) {
+	b.put(metaBucket, []byte(tipKey), hash)
+}
+
+// 写入元数据
+func (b *Batch) PutMeta(key string, value []byte) {
+	b.put(metaBucket, []byte(key), value)
+}
+
+// 删除元数据
+func (b *Batch) DeleteMeta(key string) {
+	b.put(metaBucket, []byte(key), nil)
+}
+
+// 写入索引项
+func (b *Batch) PutIndex(index string, key, value []byte) {
+	b.put(indexBucket(index), key, value)
+}
+
+// 删除索引项
+func (b *Batch) DeleteIndex(index string, key []byte) {
+	b.put(indexBucket(index), key, nil)
+}
+
+// 批次中的写操作数
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+func (b *Batch) put(bucket, key, value []byte) {
+	// 复制一份，调用方之后修改切片不影响批次
+	if value != nil {
+		value = bytes.Clone(value)
+	}
+	b.ops = append(b.ops, op{bucket: bucket, key: bytes.Clone(key), value: value})
+}
+
+// 各后端只需实现按存储桶的键值读写
+type backend interface {
+	get(bucket, key []byte) ([]byte, error)
+	forEach(bucket []byte, fn func(key, value []byte) error) error
+	write(ops []op) error
+	backup(w io.Writer) (int64, error)
+	close() error
+}
+
+// 基于backend实现Store
+type kvStore struct {
+	backend
+}
+
+func (s kvStore) GetBlock(hash []byte) (*pow.Block, error) {
+	data, err := s.get(blocksBucket, hash)
+	if err != nil {
+		return nil, err
+	}
+	var block pow.Block
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+func (s kvStore) GetTip() ([]byte, error) {
+	return s.get(metaBucket, []byte(tipKey))
+}
+
+func (s kvStore) GetMeta(key string) ([]byte, error) {
+	return s.get(metaBucket, []byte(key))
+}
+
+func (s kvStore) GetIndex(index string, key []byte) ([]byte, error) {
+	return s.get(indexBucket(index), key)
+}
+
+func (s kvStore) ForEachIndex(index string, fn func(key, value []byte) error) error {
+	return s.forEach(indexBucket(index), fn)
+}
+
+func (s kvStore) Write(b *Batch) error {
+	if b.err != nil {
+		return b.err
+	}
+	return s.write(b.ops)
+}
+
+func (s kvStore) Backup(w io.Writer) (int64, error) {
+	return s.backup(w)
+}
+
+func (s kvStore) Close() error {
+	return s.close()
+}
@@ -0,0 +1,170 @@
+package ledgerio
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/report"
+)
+
+// 导出格式
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// 导出用的区块结构
+type BlockRecord struct {
+	Height       int        `json:"height"`
+	Hash         string     `json:"hash"`
+	PreviousHash string     `json:"previous_hash"`
+	MerkleRoot   string     `json:"merkle_root"`
+	Time         time.Time  `json:"time"`
+	Bits         string     `json:"bits"`
+	Nounce       uint32     `json:"nounce"`
+	Transactions []TxRecord `json:"transactions"`
+}
+
+// 导出用的交易结构
+type TxRecord struct {
+	TxID     string         `json:"txid"`
+	Coinbase bool           `json:"coinbase"`
+	Inputs   []InputRecord  `json:"inputs,omitempty"`
+	Outputs  []OutputRecord `json:"outputs"`
+	Memo     string         `json:"memo,omitempty"`
+}
+
+type InputRecord struct {
+	Txid    string    `json:"txid"`
+	Vout    int       `json:"vout"`
+	Address string    `json:"address"`
+	Amount  tx.Amount `json:"amount"`
+}
+
+type OutputRecord struct {
+	Address string    `json:"address"`
+	Amount  tx.Amount `json:"amount"`
+}
+
+// 导出某些地址的账目历史
+func ExportHistory(w io.Writer, ab *accountbook.AccountBook, addresses []string, format string) error {
+	entries, err := report.Entries(ab, addresses)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, entries)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"height", "time", "txid", "category", "income", "expense", "fee", "counterparties", "memo"})
+		for _, e := range entries {
+			var parties []string
+			for _, f := range e.Flows {
+				parties = append(parties, fmt.Sprintf("%s:%s", f.Address, f.Amount))
+			}
+			cw.Write([]string{
+				strconv.Itoa(e.Height), e.Time.Format(time.RFC3339), e.TxID, e.Category,
+				e.Income.String(), e.Expense.String(), e.Fee.String(), strings.Join(parties, ";"), e.Memo,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// 导出整条区块链
+// CSV格式下每行对应一个交易输入或输出
+// 旧区块已被裁剪时无法导出
+func ExportChain(w io.Writer, ab *accountbook.AccountBook, format string) error {
+	if h := ab.Chain.PruneHeight(); h > 0 {
+		return fmt.Errorf("区块 #0-#%d: %w", h-1, blockchain.ErrPruned)
+	}
+	blocks := ChainRecords(ab)
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, blocks)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"height", "block_hash", "time", "txid", "coinbase", "direction", "index", "prev_txid", "prev_vout", "address", "amount", "memo"})
+		for _, b := range blocks {
+			for _, t := range b.Transactions {
+				prefix := []string{strconv.Itoa(b.Height), b.Hash, b.Time.Format(time.RFC3339), t.TxID, strconv.FormatBool(t.Coinbase)}
+				for i, in := range t.Inputs {
+					cw.Write(append(prefix, "in", strconv.Itoa(i), in.Txid, strconv.Itoa(in.Vout), in.Address, in.Amount.String(), t.Memo))
+				}
+				for i, out := range t.Outputs {
+					cw.Write(append(prefix, "out", strconv.Itoa(i), "", "", out.Address, out.Amount.String(), t.Memo))
+				}
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// 将区块链转换为导出结构
+func ChainRecords(ab *accountbook.AccountBook) []BlockRecord {
+	var blocks []BlockRecord
+	for height, block := range ab.Chain.GetBlocks() {
+		hash := block.CalculateHash()
+		record := BlockRecord{
+			Height:       height,
+			Hash:         hex.EncodeToString(hash[:]),
+			PreviousHash: hex.EncodeToString(block.PreviousHash[:]),
+			MerkleRoot:   hex.EncodeToString(block.MerkleRoot[:]),
+			Time:         time.Unix(int64(block.Timestamp), 0),
+			Bits:         hex.EncodeToString(block.Bits[:]),
+			Nounce:       block.Nounce,
+		}
+		for _, t := range block.Transactions {
+			record.Transactions = append(record.Transactions, txRecord(ab, t))
+		}
+		blocks = append(blocks, record)
+	}
+	return blocks
+}
+
+func txRecord(ab *accountbook.AccountBook, t *tx.Transaction) TxRecord {
+	record := TxRecord{TxID: hex.EncodeToString(t.ID), Coinbase: t.IsCoinbase(), Memo: ab.GetMemo(t.ID)}
+	if !record.Coinbase {
+		for _, vin := range t.Inputs {
+			in := InputRecord{
+				Txid:    hex.EncodeToString(vin.Txid),
+				Vout:    vin.Vout,
+				Address: wallet.GetAddressFromPubKeyHash(wallet.HashPubKey(vin.PubKey)),
+			}
+			if prev := ab.FindTransaction(vin.Txid); prev != nil && vin.Vout < len(prev.Outputs) {
+				in.Amount = prev.Outputs[vin.Vout].Value
+			}
+			record.Inputs = append(record.Inputs, in)
+		}
+	}
+	for _, out := range t.Outputs {
+		record.Outputs = append(record.Outputs, OutputRecord{
+			Address: wallet.GetAddressFromPubKeyHash(out.PubKeyHash),
+			Amount:  out.Value,
+		})
+	}
+	return record
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
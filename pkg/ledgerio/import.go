@@ -0,0 +1,240 @@
+package ledgerio
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+)
+
+// 导入文件中的一行：from,to,amount,memo
+type ImportRow struct {
+	Line   int
+	From   string
+	To     string
+	Amount tx.Amount
+	Memo   string
+}
+
+// 单行导入结果，Err为nil表示成功
+type RowResult struct {
+	Row    ImportRow
+	TxID   string
+	Height int // 交易所在区块高度，试运行时为-1
+	Err    error
+}
+
+// 导入选项
+type ImportOptions struct {
+	DryRun       bool   // 只校验不上链
+	BatchSize    int    // 每个区块最多打包的交易数，<=0时不限制
+	MinerAddress string // 打包区块的Coinbase奖励地址，可为空
+}
+
+// 从CSV批量导入转账，每行生成一笔签名交易并分批打包进区块，memo作为交易备注保存在本地
+// wallets 用于根据转出地址查找签名所用的钱包
+func ImportCSV(ab *accountbook.AccountBook, r io.Reader, wallets func(address string) *wallet.Wallet, opts ImportOptions) ([]RowResult, error) {
+	rows, results, err := readRows(r)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := importer{ab: ab, wallets: wallets, opts: opts, results: results}
+	if opts.DryRun {
+		imp.dryRun(rows)
+	} else {
+		imp.run(rows)
+	}
+	// 解析失败的行与处理过的行按行号合并
+	sort.SliceStable(imp.results, func(i, j int) bool {
+		return imp.results[i].Row.Line < imp.results[j].Row.Line
+	})
+	return imp.results, nil
+}
+
+type importer struct {
+	ab      *accountbook.AccountBook
+	wallets func(address string) *wallet.Wallet
+	opts    ImportOptions
+	results []RowResult
+
+	pending  []*tx.Transaction
+	indexes  []int           // pending中每笔交易对应的结果下标
+	involved map[string]bool // 当前批次中出现过的地址
+}
+
+// 逐行创建交易，同一批次内地址再次出现时先打包，避免重复选用尚未上链的UTXO
+func (imp *importer) run(rows []ImportRow) {
+	imp.involved = make(map[string]bool)
+	for _, row := range rows {
+		w, err := imp.check(row)
+		if err == nil && imp.involved[row.From] {
+			imp.flush()
+		}
+		if err == nil {
+			var t *tx.Transaction
+			if t, err = imp.ab.CreateTransaction(row.From, row.To, row.Amount, w); err == nil {
+				imp.pending = append(imp.pending, t)
+				imp.indexes = append(imp.indexes, len(imp.results))
+				imp.involved[row.From] = true
+				imp.involved[row.To] = true
+				imp.results = append(imp.results, RowResult{Row: row, TxID: hex.EncodeToString(t.ID)})
+				if imp.opts.BatchSize > 0 && len(imp.pending) >= imp.opts.BatchSize {
+					imp.flush()
+				}
+				continue
+			}
+		}
+		imp.results = append(imp.results, RowResult{Row: row, Height: -1, Err: err})
+	}
+	imp.flush()
+}
+
+// 打包当前批次，逐笔确认交易已上链后记录所在高度与备注
+// 一个批次可能被拆分为多个区块，也可能只有部分交易上链
+func (imp *importer) flush() {
+	if len(imp.pending) == 0 {
+		return
+	}
+	start := len(imp.ab.Chain.GetBlocks())
+	err := imp.ab.AddBlock(imp.pending, imp.opts.MinerAddress)
+	// 被丢弃的交易按各自的原因报告，其余交易已正常出块
+	reasons := make(map[string]error)
+	var rejected *blockchain.RejectedError
+	if errors.As(err, &rejected) {
+		for _, r := range rejected.Rejected {
+			reasons[string(r.Tx.ID)] = r.Err
+		}
+		if err == error(rejected) {
+			err = nil
+		}
+	}
+	heights := make(map[string]int)
+	for i, block := range imp.ab.Chain.GetBlocks()[start:] {
+		for _, t := range block.Transactions {
+			heights[string(t.ID)] = start + i
+		}
+	}
+	for i, t := range imp.pending {
+		result := &imp.results[imp.indexes[i]]
+		height, ok := heights[string(t.ID)]
+		switch {
+		case ok && imp.ab.FindTransaction(t.ID) != nil:
+			result.Height = height
+			if result.Row.Memo != "" {
+				if err := imp.ab.SetMemo(t.ID, result.Row.Memo); err != nil {
+					result.Err = fmt.Errorf("已打包进区块 #%d，保存备注失败: %w", height, err)
+				}
+			}
+		case reasons[string(t.ID)] != nil:
+			result.Height, result.Err = -1, reasons[string(t.ID)]
+		case err != nil:
+			result.Height, result.Err = -1, err
+		default:
+			result.Height, result.Err = -1, errors.New("交易未被打包进区块")
+		}
+	}
+	imp.pending = nil
+	imp.indexes = nil
+	imp.involved = make(map[string]bool)
+}
+
+// 试运行：按行模拟余额变化，不创建交易
+// 初始余额只计可以花费的输出，不含未成熟的挖矿奖励与已被交易池中交易花费的输出
+func (imp *importer) dryRun(rows []ImportRow) {
+	balances := make(map[string]tx.Amount)
+	balanceOf := func(address string) tx.Amount {
+		if b, ok := balances[address]; ok {
+			return b
+		}
+		var spendable tx.Amount
+		for _, out := range imp.ab.UTXOSet.FindSpendableUTXO(wallet.GetPubKeyHashFromAddress(address)) {
+			spendable += out.Value
+		}
+		return spendable
+	}
+	for _, row := range rows {
+		result := RowResult{Row: row, Height: -1}
+		if _, err := imp.check(row); err != nil {
+			result.Err = err
+		} else if balanceOf(row.From) < row.Amount {
+			result.Err = errors.New("余额不足")
+		} else {
+			balances[row.From] = balanceOf(row.From) - row.Amount
+			balances[row.To] = balanceOf(row.To) + row.Amount
+		}
+		imp.results = append(imp.results, result)
+	}
+}
+
+// 校验一行内容并找到转出钱包
+func (imp *importer) check(row ImportRow) (*wallet.Wallet, error) {
+	if !wallet.ValidateAddress(row.From) {
+		return nil, fmt.Errorf("转出地址无效: %s", row.From)
+	}
+	if !wallet.ValidateAddress(row.To) {
+		return nil, fmt.Errorf("收款地址无效: %s", row.To)
+	}
+	if row.Amount <= 0 {
+		return nil, errors.New("金额必须为正数")
+	}
+	w := imp.wallets(row.From)
+	if w == nil {
+		return nil, fmt.Errorf("找不到地址 %s 对应的钱包", row.From)
+	}
+	return w, nil
+}
+
+// 读取CSV，第一行为表头(from,to,amount,memo)时跳过
+// 无法解析的行直接记入结果
+func readRows(r io.Reader) ([]ImportRow, []RowResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var rows []ImportRow
+	var results []RowResult
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				results = append(results, RowResult{Row: ImportRow{Line: parseErr.StartLine}, Height: -1, Err: err})
+				continue
+			}
+			return nil, nil, err
+		}
+		if first && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "from") {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		row := ImportRow{Line: line}
+		if len(record) < 3 || len(record) > 4 {
+			results = append(results, RowResult{Row: row, Height: -1, Err: errors.New("列数应为3或4: from,to,amount[,memo]")})
+			continue
+		}
+		row.From = strings.TrimSpace(record[0])
+		row.To = strings.TrimSpace(record[1])
+		if len(record) == 4 {
+			row.Memo = record[3]
+		}
+		row.Amount, err = tx.ParseAmount(record[2])
+		if err != nil {
+			results = append(results, RowResult{Row: row, Height: -1, Err: err})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, results, nil
+}
@@ -0,0 +1,190 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+)
+
+// 矿工配置
+type Config struct {
+	Address      string        // Coinbase奖励地址
+	MaxTxs       int           // 每个区块最多打包的交易数，<=0时不限制
+	MineEmpty    bool          // 交易池为空时是否也挖只含Coinbase的区块
+	Workers      int           // 挖矿协程数，<=0时使用CPU核数
+	PollInterval time.Duration // 检查链尾与交易池变化的间隔，<=0时使用默认值
+}
+
+const defaultPollInterval = 200 * time.Millisecond
+
+// 区块被拒绝后重试的最长等待时间
+const maxBackoff = 30 * time.Second
+
+// 矿工运行状态
+type Status struct {
+	Running     bool
+	Address     string
+	BlocksMined int
+	LastBlock   [32]byte
+	HashRate    float64 // 最近一次挖矿的平均算力（次/秒）
+	PoolSize    int
+	LastError   error
+	Evicted     int // 区块被拒绝后因不再合法而移出交易池的交易数
+}
+
+// 后台矿工：持续从交易池选取交易打包挖矿
+// 链尾或交易池变化时放弃当前区块，按最新状态重新构建
+type Miner struct {
+	chain *blockchain.Blockchain
+	pool  *blockchain.TxPool
+	cfg   Config
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	status Status
+}
+
+// 创建矿工，需调用Start后才开始挖矿
+func New(chain *blockchain.Blockchain, pool *blockchain.TxPool, cfg Config) *Miner {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	return &Miner{chain: chain, pool: pool, cfg: cfg}
+}
+
+// 启动后台挖矿
+func (m *Miner) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return errors.New("矿工已在运行")
+	}
+	if !wallet.ValidateAddress(m.cfg.Address) {
+		return errors.New("奖励地址无效")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+	m.status.Running = true
+	m.status.Address = m.cfg.Address
+	go m.run(ctx, m.done)
+	return nil
+}
+
+// 停止挖矿并等待后台协程退出
+func (m *Miner) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+
+	m.mu.Lock()
+	m.status.Running = false
+	m.mu.Unlock()
+}
+
+// 查询运行状态
+func (m *Miner) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := m.status
+	status.PoolSize = m.pool.Size()
+	return status
+}
+
+// 挖矿主循环
+func (m *Miner) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	failures := 0
+	for ctx.Err() == nil {
+		version := m.pool.Version()
+		tmpl := m.chain.GetBlockTemplate(m.pool, m.cfg.MaxTxs)
+		tip := tmpl.PreviousHash
+		if len(tmpl.Transactions) == 0 && !m.cfg.MineEmpty {
+			if m.pool.Size() > 0 {
+				// 交易池中的交易尚未到达时间锁，下个周期重建模板
+				m.sleep(ctx, m.cfg.PollInterval)
+			} else {
+				m.wait(ctx, tip, version)
+			}
+			continue
+		}
+		block := tmpl.NewBlock(m.cfg.Address)
+
+		mineCtx, cancel := context.WithCancel(ctx)
+		stopWatch := make(chan struct{})
+		go func() {
+			m.wait(mineCtx, tip, version)
+			cancel()
+			close(stopWatch)
+		}()
+		hash, stats, err := block.Mine(mineCtx, m.cfg.Workers)
+		cancel()
+		<-stopWatch
+		if err != nil {
+			// 被取消：链尾或交易池已变化，或矿工被停止
+			continue
+		}
+
+		err = m.chain.SubmitBlock(&block)
+		m.mu.Lock()
+		m.status.HashRate = stats.HashRate()
+		m.status.LastError = err
+		if err == nil {
+			m.status.BlocksMined++
+			m.status.LastBlock = hash
+		}
+		m.mu.Unlock()
+		switch {
+		case err == nil:
+			failures = 0
+			m.pool.RemoveTx(block.Transactions)
+		case errors.Is(err, blockchain.ErrStaleTip):
+			// 挖矿期间链尾已变化，基于新链尾重建模板
+		default:
+			// 区块被拒绝：移除交易池中不再合法的交易，并逐次加长等待，避免反复挖出同样的无效区块
+			evicted := m.pool.RemoveInvalid(m.chain)
+			m.mu.Lock()
+			m.status.Evicted += len(evicted)
+			m.mu.Unlock()
+			failures++
+			m.sleep(ctx, min(m.cfg.PollInterval<<min(failures, 16), maxBackoff))
+		}
+	}
+}
+
+// 等待d，或直到ctx被取消
+func (m *Miner) sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// 等待直到链尾或交易池发生变化，或ctx被取消
+func (m *Miner) wait(ctx context.Context, tip [32]byte, version uint64) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.chain.TipHash() != tip || m.pool.Version() != version {
+				return
+			}
+		}
+	}
+}
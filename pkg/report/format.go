@@ -0,0 +1,98 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// 报表输出格式
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// 按指定格式输出报表
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatText:
+		return r.WriteText(w)
+	case FormatCSV:
+		return r.WriteCSV(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", format)
+	}
+}
+
+// 以文本表格输出
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, "== 收支表 ==")
+	fmt.Fprintln(tw, "Category\tCount\tIncome\tExpense\tNet\t")
+	for _, l := range r.Statement {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t\n", l.Category, l.Count, l.Income, l.Expense, l.Net)
+	}
+
+	fmt.Fprintf(tw, "\n== 期末余额（按%s） ==\n", r.Period)
+	fmt.Fprintln(tw, "Period\tBalance\t")
+	for _, b := range r.Balances {
+		fmt.Fprintf(tw, "%s\t%s\t\n", b.Period, b.Balance)
+	}
+
+	fmt.Fprintln(tw, "\n== 主要对手方 ==")
+	fmt.Fprintln(tw, "Address\tCount\tReceived\tSent\t")
+	for _, c := range r.Counterparties {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t\n", c.Address, c.Count, c.Received, c.Sent)
+	}
+	return tw.Flush()
+}
+
+// 以CSV输出，三张表之间以空行分隔
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	itoa := strconv.Itoa
+
+	records := [][]string{{"category", "count", "income", "expense", "net"}}
+	for _, l := range r.Statement {
+		records = append(records, []string{l.Category, itoa(l.Count), l.Income.String(), l.Expense.String(), l.Net.String()})
+	}
+	records = append(records, nil, []string{"period", "balance"})
+	for _, b := range r.Balances {
+		records = append(records, []string{b.Period, b.Balance.String()})
+	}
+	records = append(records, nil, []string{"counterparty", "count", "received", "sent"})
+	for _, c := range r.Counterparties {
+		records = append(records, []string{c.Address, itoa(c.Count), c.Received.String(), c.Sent.String()})
+	}
+
+	for _, record := range records {
+		if record == nil {
+			cw.Flush()
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// 以JSON输出
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
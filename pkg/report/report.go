@@ -0,0 +1,332 @@
+package report
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+)
+
+// 收支分类
+const (
+	CategoryMining   = "mining"   // 挖矿/Coinbase收入
+	CategoryReceive  = "receive"  // 外部转入
+	CategorySend     = "send"     // 向外部转出
+	CategoryInternal = "internal" // 地址集合内部互转
+	CategoryFee      = "fee"      // 地址集合支付的交易手续费
+)
+
+// 余额统计周期
+type Period string
+
+const (
+	Daily   Period = "day"
+	Monthly Period = "month"
+)
+
+// 周期对应的时间格式
+func (p Period) layout() string {
+	if p == Daily {
+		return "2006-01-02"
+	}
+	return "2006-01"
+}
+
+// 推进到下一个周期
+func (p Period) next(t time.Time) time.Time {
+	if p == Daily {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// 与某个对手方之间的资金往来
+type Flow struct {
+	Address string    `json:"address"`
+	Amount  tx.Amount `json:"amount"`
+}
+
+// 账目明细：一笔与地址集合相关的交易
+type Entry struct {
+	Height   int       `json:"height"`
+	Time     time.Time `json:"time"`
+	TxID     string    `json:"txid"`
+	Category string    `json:"category"`
+	Income   tx.Amount `json:"income"`
+	Expense  tx.Amount `json:"expense"`
+	Fee      tx.Amount `json:"fee,omitempty"` // 地址集合支付的手续费，不计入Expense，在收支表中单列
+	Flows    []Flow    `json:"counterparties,omitempty"`
+	Memo     string    `json:"memo,omitempty"`
+}
+
+// 收支表中的一行
+type StatementLine struct {
+	Category string    `json:"category"`
+	Count    int       `json:"count"`
+	Income   tx.Amount `json:"income"`
+	Expense  tx.Amount `json:"expense"`
+	Net      tx.Amount `json:"net"`
+}
+
+// 某周期期末余额
+type BalancePoint struct {
+	Period  string    `json:"period"`
+	Balance tx.Amount `json:"balance"`
+}
+
+// 对手方汇总
+type Counterparty struct {
+	Address  string    `json:"address"`
+	Count    int       `json:"count"`
+	Received tx.Amount `json:"received"` // 从对方收到
+	Sent     tx.Amount `json:"sent"`     // 付给对方
+}
+
+// 账目报表
+type Report struct {
+	Addresses      []string        `json:"addresses"`
+	Period         Period          `json:"period"`
+	Statement      []StatementLine `json:"statement"`
+	Balances       []BalancePoint  `json:"balances"`
+	Counterparties []Counterparty  `json:"counterparties"`
+}
+
+// 按区块顺序列出与地址集合相关的所有账目
+func Entries(ab *accountbook.AccountBook, addresses []string) ([]Entry, error) {
+	owned, err := ownedSet(addresses)
+	if err != nil {
+		return nil, err
+	}
+	if h := ab.Chain.PruneHeight(); h > 0 {
+		return nil, fmt.Errorf("账目需要完整的区块，区块 #0-#%d: %w", h-1, blockchain.ErrPruned)
+	}
+	// 建立交易索引，便于查找输入引用的输出
+	blocks := ab.Chain.GetBlocks()
+	txIndex := make(map[string]*tx.Transaction)
+	for _, block := range blocks {
+		for _, t := range block.Transactions {
+			txIndex[string(t.ID)] = t
+		}
+	}
+
+	var entries []Entry
+	for height, block := range blocks {
+		for _, t := range block.Transactions {
+			entry, ok := classify(t, owned, txIndex)
+			if !ok {
+				continue
+			}
+			entry.Height = height
+			entry.Time = time.Unix(int64(block.Timestamp), 0)
+			entry.Memo = ab.GetMemo(t.ID)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// 生成报表，topN<=0时列出全部对手方
+func New(ab *accountbook.AccountBook, addresses []string, period Period, topN int) (*Report, error) {
+	if period != Daily && period != Monthly {
+		return nil, fmt.Errorf("不支持的统计周期: %s", period)
+	}
+	entries, err := Entries(ab, addresses)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{
+		Addresses:      addresses,
+		Period:         period,
+		Statement:      BuildStatement(entries),
+		Balances:       BuildBalances(entries, period),
+		Counterparties: TopCounterparties(entries, topN),
+	}, nil
+}
+
+// 按分类汇总收支，手续费单列为fee一行
+func BuildStatement(entries []Entry) []StatementLine {
+	order := []string{CategoryMining, CategoryReceive, CategorySend, CategoryInternal, CategoryFee}
+	lines := make(map[string]*StatementLine)
+	for _, c := range order {
+		lines[c] = &StatementLine{Category: c}
+	}
+	total := StatementLine{Category: "total"}
+	for _, e := range entries {
+		line := lines[e.Category]
+		line.Count++
+		line.Income += e.Income
+		line.Expense += e.Expense
+		total.Count++
+		total.Income += e.Income
+		total.Expense += e.Expense + e.Fee
+		if e.Fee > 0 {
+			lines[CategoryFee].Count++
+			lines[CategoryFee].Expense += e.Fee
+		}
+	}
+
+	var result []StatementLine
+	for _, c := range order {
+		line := lines[c]
+		line.Net = line.Income - line.Expense
+		result = append(result, *line)
+	}
+	total.Net = total.Income - total.Expense
+	return append(result, total)
+}
+
+// 计算每个周期期末的余额，中间没有交易的周期沿用上期余额
+func BuildBalances(entries []Entry, period Period) []BalancePoint {
+	if len(entries) == 0 {
+		return nil
+	}
+	layout := period.layout()
+	closing := make(map[string]tx.Amount)
+	var balance tx.Amount
+	for _, e := range entries {
+		balance += e.Income - e.Expense - e.Fee
+		closing[e.Time.Format(layout)] = balance
+	}
+
+	var points []BalancePoint
+	last := entries[len(entries)-1].Time.Format(layout)
+	balance = 0
+	for t := periodStart(entries[0].Time, period); ; t = period.next(t) {
+		key := t.Format(layout)
+		if b, ok := closing[key]; ok {
+			balance = b
+		}
+		points = append(points, BalancePoint{Period: key, Balance: balance})
+		if key == last {
+			break
+		}
+	}
+	return points
+}
+
+// 统计往来金额最大的对手方
+func TopCounterparties(entries []Entry, topN int) []Counterparty {
+	stats := make(map[string]*Counterparty)
+	for _, e := range entries {
+		for _, f := range e.Flows {
+			c, ok := stats[f.Address]
+			if !ok {
+				c = &Counterparty{Address: f.Address}
+				stats[f.Address] = c
+			}
+			c.Count++
+			if e.Category == CategorySend {
+				c.Sent += f.Amount
+			} else {
+				c.Received += f.Amount
+			}
+		}
+	}
+
+	result := make([]Counterparty, 0, len(stats))
+	for _, c := range stats {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		vi := result[i].Received + result[i].Sent
+		vj := result[j].Received + result[j].Sent
+		if vi != vj {
+			return vi > vj
+		}
+		return result[i].Address < result[j].Address
+	})
+	if topN > 0 && len(result) > topN {
+		result = result[:topN]
+	}
+	return result
+}
+
+// 解析地址集合，键为公钥哈希
+func ownedSet(addresses []string) (map[string]bool, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("未指定地址")
+	}
+	owned := make(map[string]bool)
+	for _, addr := range addresses {
+		if !wallet.ValidateAddress(addr) {
+			return nil, fmt.Errorf("地址无效: %s", addr)
+		}
+		owned[string(wallet.GetPubKeyHashFromAddress(addr))] = true
+	}
+	return owned, nil
+}
+
+// 判断交易对地址集合的影响并归类
+func classify(t *tx.Transaction, owned map[string]bool, txIndex map[string]*tx.Transaction) (Entry, bool) {
+	var spent tx.Amount
+	var senders []string
+	if !t.IsCoinbase() {
+		for _, vin := range t.Inputs {
+			owner := wallet.HashPubKey(vin.PubKey)
+			if !owned[string(owner)] {
+				senders = append(senders, wallet.GetAddressFromPubKeyHash(owner))
+				continue
+			}
+			if prev, ok := txIndex[string(vin.Txid)]; ok && vin.Vout < len(prev.Outputs) {
+				spent += prev.Outputs[vin.Vout].Value
+			}
+		}
+	}
+	var received, paid tx.Amount
+	var recipients []Flow
+	for _, out := range t.Outputs {
+		if owned[string(out.PubKeyHash)] {
+			received += out.Value
+		} else {
+			paid += out.Value
+			recipients = append(recipients, Flow{wallet.GetAddressFromPubKeyHash(out.PubKeyHash), out.Value})
+		}
+	}
+	if spent == 0 && received == 0 {
+		return Entry{}, false
+	}
+
+	entry := Entry{TxID: hex.EncodeToString(t.ID)}
+	switch {
+	case t.IsCoinbase():
+		entry.Category = CategoryMining
+		entry.Income = received
+	case spent == 0:
+		entry.Category = CategoryReceive
+		entry.Income = received
+		if len(senders) > 0 {
+			entry.Flows = []Flow{{senders[0], received}}
+		}
+	case len(recipients) == 0:
+		// 资金未离开地址集合，减少的部分即手续费
+		entry.Category = CategoryInternal
+		if received > spent {
+			entry.Income = received - spent
+		} else {
+			entry.Fee = spent - received
+		}
+	default:
+		// 付给对手方的金额计为支出，其余减少的部分为手续费
+		// 与外部地址共同出资时，手续费最多按地址集合的净流出计算
+		entry.Category = CategorySend
+		entry.Expense = min(paid, spent-received)
+		entry.Fee = spent - received - entry.Expense
+		entry.Flows = recipients
+	}
+	return entry, true
+}
+
+// 某时间所在周期的起点
+func periodStart(t time.Time, period Period) time.Time {
+	y, m, d := t.Date()
+	if period == Daily {
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
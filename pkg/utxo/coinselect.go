@@ -0,0 +1,156 @@
+package utxo
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+)
+
+// 选币策略：从候选UTXO中选出一组足以覆盖target的输出
+// 返回选中输出的总额，总额小于target表示余额不足
+type CoinSelector interface {
+	Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput)
+}
+
+// 按链上顺序依次选取，直到金额足够（原有的默认策略）
+type ChainOrder struct{}
+
+func (ChainOrder) Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	return accumulate(utxos, target)
+}
+
+// 优先选用金额最大的UTXO，输入数量最少
+type LargestFirst struct{}
+
+func (LargestFirst) Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	sorted := slices.Clone(utxos)
+	slices.SortStableFunc(sorted, func(a, b UTXOOutput) int { return cmp.Compare(b.Value, a.Value) })
+	return accumulate(sorted, target)
+}
+
+// 优先选用金额最小的UTXO，顺带清理零散输出
+type SmallestFirst struct{}
+
+func (SmallestFirst) Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	sorted := slices.Clone(utxos)
+	slices.SortStableFunc(sorted, func(a, b UTXOOutput) int { return cmp.Compare(a.Value, b.Value) })
+	return accumulate(sorted, target)
+}
+
+// 分支定界：寻找总额恰好等于target的组合，使交易无需找零
+// 找不到时交给Fallback（默认LargestFirst）
+type BranchAndBound struct {
+	MaxTries int // 最多搜索的节点数，<=0时使用默认值
+	Fallback CoinSelector
+}
+
+const defaultBnBTries = 100000
+
+func (b BranchAndBound) Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	sorted := slices.Clone(utxos)
+	slices.SortStableFunc(sorted, func(x, y UTXOOutput) int { return cmp.Compare(y.Value, x.Value) })
+	// remaining[i] 为sorted[i:]的总额，用于剪枝
+	remaining := make([]tx.Amount, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+
+	tries := b.MaxTries
+	if tries <= 0 {
+		tries = defaultBnBTries
+	}
+	var best, chosen []int
+	found := false
+	// 深度优先：对每个UTXO依次尝试“选”与“不选”
+	var search func(i int, sum tx.Amount)
+	search = func(i int, sum tx.Amount) {
+		if tries <= 0 || found {
+			return
+		}
+		tries--
+		if sum > target || sum+remaining[i] < target {
+			return
+		}
+		if sum == target {
+			found = true
+			best = slices.Clone(chosen)
+			return
+		}
+		if i == len(sorted) {
+			return
+		}
+		chosen = append(chosen, i)
+		search(i+1, sum+sorted[i].Value)
+		chosen = chosen[:len(chosen)-1]
+		search(i+1, sum)
+	}
+	search(0, 0)
+
+	if !found {
+		fallback := b.Fallback
+		if fallback == nil {
+			fallback = LargestFirst{}
+		}
+		return fallback.Select(utxos, target)
+	}
+	var selected []UTXOOutput
+	for _, i := range best {
+		selected = append(selected, sorted[i])
+	}
+	return target, selected
+}
+
+// 随机改进（CIP-2 Random-Improve）：先随机选取直到金额足够，
+// 再尝试随机追加输入，使找零接近target，且总额不超过3倍target
+type RandomImprove struct {
+	Rand *rand.Rand // 为nil时使用全局随机源
+}
+
+func (r RandomImprove) Select(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	shuffled := slices.Clone(utxos)
+	shuffle := rand.Shuffle
+	if r.Rand != nil {
+		shuffle = r.Rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	sum, selected := accumulate(shuffled, target)
+	if sum < target {
+		return sum, selected
+	}
+	// 改进阶段：理想总额为2倍target（找零约等于付款额），便于将来的付款
+	ideal, limit := 2*target, 3*target
+	for _, out := range shuffled[len(selected):] {
+		next := sum + out.Value
+		if next > limit || abs(ideal-next) >= abs(ideal-sum) {
+			continue
+		}
+		sum = next
+		selected = append(selected, out)
+	}
+	return sum, selected
+}
+
+// 按给定顺序累加，直到金额足够
+func accumulate(utxos []UTXOOutput, target tx.Amount) (tx.Amount, []UTXOOutput) {
+	var accumulated tx.Amount
+	var selected []UTXOOutput
+	for _, out := range utxos {
+		if accumulated >= target {
+			// 选用的Output够用了就停止
+			break
+		}
+		accumulated += out.Value
+		selected = append(selected, out)
+	}
+	return accumulated, selected
+}
+
+func abs(x tx.Amount) tx.Amount {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,116 @@
+package utxo
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+)
+
+// 地址余额明细
+// 三者之和为待确认交易全部上链后的余额
+type Balance struct {
+	Confirmed   tx.Amount // 已确认且可花费，不含已被待确认交易花费的输出
+	Unconfirmed tx.Amount // 待确认交易转入该地址的金额（含找零）
+	Immature    tx.Amount // 尚未成熟的挖矿奖励
+}
+
+// 余额合计
+func (b Balance) Total() tx.Amount {
+	return b.Confirmed + b.Unconfirmed + b.Immature
+}
+
+// 交易池中与该地址相关的待确认交易：花费该地址的输出或向该地址付款
+func (u *UTXOSet) PendingTransactions(pubKeyHash []byte) []*tx.Transaction {
+	if u.Pool == nil {
+		return nil
+	}
+	var pending []*tx.Transaction
+	for _, t := range u.Pool.GetTransactions() {
+		if involves(t, pubKeyHash) {
+			pending = append(pending, t)
+		}
+	}
+	return pending
+}
+
+// 查找可用于构造新交易的未花费输出
+// 排除已被待确认交易花费的输出（避免重复选用）与尚未成熟的Coinbase输出
+func (u *UTXOSet) FindSpendableUTXO(pubKeyHash []byte) []UTXOOutput {
+	spent := u.pendingSpent()
+	height := len(u.Blockchain.GetBlocks())
+	var utxos []UTXOOutput
+	for _, out := range u.FindUTXO(pubKeyHash) {
+		if !spent[outpoint(out.TxID, out.Vout)] && u.mature(out, height) {
+			utxos = append(utxos, out)
+		}
+	}
+	return utxos
+}
+
+// 查询地址的余额明细
+func (u *UTXOSet) GetBalance(pubKeyHash []byte) Balance {
+	var balance Balance
+	spent := u.pendingSpent()
+	height := len(u.Blockchain.GetBlocks())
+	for _, out := range u.FindUTXO(pubKeyHash) {
+		switch {
+		case spent[outpoint(out.TxID, out.Vout)]:
+		case !u.mature(out, height):
+			balance.Immature += out.Value
+		default:
+			balance.Confirmed += out.Value
+		}
+	}
+	// 待确认交易的输出若又被其他待确认交易花费，则不再计入
+	for _, t := range u.PendingTransactions(pubKeyHash) {
+		for idx, out := range t.Outputs {
+			if bytes.Equal(out.PubKeyHash, pubKeyHash) && !spent[outpoint(t.ID, idx)] {
+				balance.Unconfirmed += out.Value
+			}
+		}
+	}
+	return balance
+}
+
+// 输出能否被高度为height的区块中的交易花费
+func (u *UTXOSet) mature(out UTXOOutput, height int) bool {
+	return !out.Coinbase || height-out.Height >= u.Blockchain.Net.CoinbaseMaturity
+}
+
+// 交易池中交易已花费的输出
+func (u *UTXOSet) pendingSpent() map[string]bool {
+	spent := make(map[string]bool)
+	if u.Pool == nil {
+		return spent
+	}
+	for _, t := range u.Pool.GetTransactions() {
+		for _, vin := range t.Inputs {
+			spent[outpoint(vin.Txid, vin.Vout)] = true
+		}
+	}
+	return spent
+}
+
+// 判断交易是否花费或收到该地址的资金
+func involves(t *tx.Transaction, pubKeyHash []byte) bool {
+	for _, out := range t.Outputs {
+		if bytes.Equal(out.PubKeyHash, pubKeyHash) {
+			return true
+		}
+	}
+	if t.IsCoinbase() {
+		return false
+	}
+	for _, vin := range t.Inputs {
+		if bytes.Equal(wallet.HashPubKey(vin.PubKey), pubKeyHash) {
+			return true
+		}
+	}
+	return false
+}
+
+func outpoint(txid []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txid, vout)
+}
@@ -2,10 +2,12 @@ package utxo
 
 import (
 	"bytes"
+	"cmp"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"slices"
 
 	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
@@ -16,145 +18,465 @@ import (
 // UTXO集
 type UTXOSet struct {
 	Blockchain *blockchain.Blockchain
+	Pool       *blockchain.TxPool // 待确认交易所在的交易池，可为nil
 }
 
 // 查询未花费输出专用数据结构
 type UTXOOutput struct {
-	TxID  []byte
-	Vout  int
-	Value int // 金额
+	TxID     []byte
+	Vout     int
+	Value    tx.Amount // 金额
+	Height   int       // 所在区块高度
+	Coinbase bool      // 是否为挖矿奖励
 }
 
-// 查找某地址所有未花费输出（查询余额用）
+// 查找某地址所有未花费输出（查询余额用），按链上顺序排列
 func (u *UTXOSet) FindUTXO(pubKeyHash []byte) []UTXOOutput {
 	var utxos []UTXOOutput
-	spentTXOs := make(map[string][]int) // 记录已经消费掉的输出，使用Output ID作为键，索引作为值
-	// 两层循环遍历每一笔交易
-	for _, block := range u.Blockchain.Blocks {
-		for _, t := range block.Transactions {
-			// 处理输入，标记已花费的输出
-			if !t.IsCoinbase() {
-				for _, vin := range t.Inputs {
-					if bytes.Equal(wallet.HashPubKey(vin.PubKey), pubKeyHash) {
-						spentTXOs[string(vin.Txid)] = append(spentTXOs[string(vin.Txid)], vin.Vout)
-					}
-				}
-			}
-		}
+	for _, out := range u.Blockchain.FindUTXO(pubKeyHash) {
+		utxos = append(utxos, UTXOOutput{
+			TxID:     out.TxID,
+			Vout:     out.Vout,
+			Value:    out.Value,
+			Height:   out.Height,
+			Coinbase: out.Coinbase,
+		})
 	}
+	return utxos
+}
 
-	for _, block := range u.Blockchain.Blocks {
-		for _, t := range block.Transactions {
-			txIDStr := string(t.ID)
-			// 处理输出，将当前地址下未花费的输出加入Output
-			for idx, out := range t.Outputs {
-				if bytes.Equal(out.PubKeyHash, pubKeyHash) {
-					// 检查该输出是否已被花费
-					spentFlag := false
-					if spentTXOs[txIDStr] != nil {
-						if slices.Contains(spentTXOs[txIDStr], idx) {
-							// 若当前Output被消费掉，直接跳过
-							spentFlag = true
-						}
-					}
-					if spentFlag {
-						continue
-					}
-					utxos = append(utxos, UTXOOutput{
-						TxID:  t.ID,
-						Vout:  idx,
-						Value: out.Value,
-					})
-				}
-			}
+// 返回足以覆盖amount的未花费输出
+func (u *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount tx.Amount) (tx.Amount, []UTXOOutput) {
+	return u.SelectSpendableOutputs(pubKeyHash, amount, ChainOrder{})
+}
+
+// 按指定选币策略返回足以覆盖amount的未花费输出
+func (u *UTXOSet) SelectSpendableOutputs(pubKeyHash []byte, amount tx.Amount, selector CoinSelector) (tx.Amount, []UTXOOutput) {
+	return selector.Select(u.FindSpendableUTXO(pubKeyHash), amount)
+}
+
+// 构造交易时的可选项
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	selector CoinSelector
+	fee      tx.Amount // 固定手续费
+	feeRate  tx.Amount // 每1000字节的手续费
+	lockTime uint32    // 绝对时间锁
+	sequence uint32    // 各输入的Sequence
+}
+
+// 指定选币策略，默认按链上顺序选取
+func WithCoinSelector(selector CoinSelector) TxOption {
+	return func(o *txOptions) {
+		o.selector = selector
+	}
+}
+
+// 指定固定手续费，默认为0
+func WithFee(fee tx.Amount) TxOption {
+	return func(o *txOptions) {
+		o.fee = fee
+	}
+}
+
+// 按交易大小计算手续费，单位为每1000字节的金额
+// 与WithFee同时使用时取两者中较大的一个
+func WithFeeRate(perKB tx.Amount) TxOption {
+	return func(o *txOptions) {
+		o.feeRate = perKB
+	}
+}
+
+// 设置绝对时间锁：小于tx.LockTimeThreshold时为区块高度，否则为Unix时间戳
+// 交易只能被打包进高度或时间超过lockTime的区块，如定期发放的工资
+func WithLockTime(lockTime uint32) TxOption {
+	return func(o *txOptions) {
+		o.lockTime = lockTime
+		if lockTime != 0 && o.sequence == tx.SequenceFinal {
+			// 至少一个输入不为SequenceFinal，时间锁才生效
+			o.sequence = tx.SequenceFinal - 1
 		}
 	}
-	return utxos
+}
 
+// 设置各输入的Sequence，用于相对时间锁，见tx.SequenceBlocks与tx.SequenceSeconds
+// 如托管资金须在收到后若干区块才能转出
+func WithSequence(sequence uint32) TxOption {
+	return func(o *txOptions) {
+		o.sequence = sequence
+	}
 }
 
-// 返回足以覆盖amount的未花费输出
-func (u *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, []UTXOOutput) {
-	accumulated := 0
-	var selectedUTXOs []UTXOOutput
-	utxos := u.FindUTXO(pubKeyHash)
-	for _, out := range utxos {
-		if accumulated >= amount {
-			// 选用的Output够用了就停止
-			break
+// 声明交易可被替换（RBF）：交易进入交易池后，可用BumpFee或CancelTransaction
+// 构造手续费更高的交易替换它
+func WithReplaceable() TxOption {
+	return func(o *txOptions) {
+		if o.sequence > tx.SequenceMaxReplaceable {
+			o.sequence = tx.SequenceMaxReplaceable
 		}
-		accumulated += out.Value
-		selectedUTXOs = append(selectedUTXOs, out)
 	}
-	return accumulated, selectedUTXOs
+}
+
+func applyOptions(opts []TxOption) txOptions {
+	o := txOptions{selector: ChainOrder{}, sequence: tx.SequenceFinal}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// 一笔付款：收款地址与金额
+type Payment struct {
+	To     string
+	Amount tx.Amount
 }
 
 // 构造新交易
-func (u *UTXOSet) CreateTransaction(from, to string, amount int, w *wallet.Wallet) (*tx.Transaction, error) {
+func (u *UTXOSet) CreateTransaction(from, to string, amount tx.Amount, w *wallet.Wallet, opts ...TxOption) (*tx.Transaction, error) {
+	return u.CreateBatchTransaction(from, []Payment{{To: to, Amount: amount}}, w, opts...)
+}
+
+// 构造向多个收款方付款的交易，每个收款方一个输出，剩余部分找零
+func (u *UTXOSet) CreateBatchTransaction(from string, payments []Payment, w *wallet.Wallet, opts ...TxOption) (*tx.Transaction, error) {
+	o := applyOptions(opts)
+	amount, err := sumPayments(payments)
+	if err != nil {
+		return nil, err
+	}
 	pubKeyHash := wallet.GetPubKeyHashFromAddress(from)
-	accumulated, validOutputs := u.FindSpendableOutputs(pubKeyHash, amount)
-	if accumulated < amount {
-		return nil, errors.New("余额不足")
+	return o.buildWithFee(func(fee tx.Amount) (*tx.Transaction, error) {
+		total, err := amount.Add(fee)
+		if err != nil {
+			return nil, err
+		}
+		accumulated, validOutputs := u.SelectSpendableOutputs(pubKeyHash, total, o.selector)
+		if accumulated < total {
+			return nil, errors.New("余额不足")
+		}
+
+		newTx := &tx.Transaction{
+			ID:       nil,
+			Version:  tx.TxVersion,
+			LockTime: o.lockTime,
+			Inputs:   newInputs(validOutputs, w.PublicKey, o.sequence),
+			Outputs:  newOutputs(payments, accumulated-total, pubKeyHash),
+		}
+		newTx.ID = newTx.CalcID()
+		// 签名
+		if err := u.SignTransaction(newTx, w.PrivateKey); err != nil {
+			return nil, err
+		}
+		return newTx, nil
+	})
+}
+
+// 从多个钱包中依次选取输入构造交易，每个输入由其所属钱包签名
+// 找零转入changeAddress
+func (u *UTXOSet) CreateMultiWalletTransaction(wallets []*wallet.Wallet, payments []Payment, changeAddress string, opts ...TxOption) (*tx.Transaction, error) {
+	o := applyOptions(opts)
+	if len(wallets) == 0 {
+		return nil, errors.New("没有可用的钱包")
 	}
-	var inputs []tx.TXInput
-	var outputs []tx.TXOutput
+	amount, err := sumPayments(payments)
+	if err != nil {
+		return nil, err
+	}
+	return o.buildWithFee(func(fee tx.Amount) (*tx.Transaction, error) {
+		total, err := amount.Add(fee)
+		if err != nil {
+			return nil, err
+		}
+		var accumulated tx.Amount
+		var inputs []tx.TXInput
+		seen := make(map[string]bool)
+		for _, w := range wallets {
+			if accumulated >= total {
+				break
+			}
+			// 同一钱包只取一次，避免重复选用UTXO
+			if seen[string(w.PublicKey)] {
+				continue
+			}
+			seen[string(w.PublicKey)] = true
+			got, outs := u.SelectSpendableOutputs(wallet.HashPubKey(w.PublicKey), total-accumulated, o.selector)
+			accumulated += got
+			inputs = append(inputs, newInputs(outs, w.PublicKey, o.sequence)...)
+		}
+		if accumulated < total {
+			return nil, errors.New("余额不足")
+		}
 
-	// 构造输入
-	for _, utxo := range validOutputs {
-		input := tx.TXInput{
-			Txid:      utxo.TxID,
-			Vout:      utxo.Vout,
-			Signature: nil, // 签名后面再加
-			PubKey:    w.PublicKey,
+		newTx := &tx.Transaction{
+			ID:       nil,
+			Version:  tx.TxVersion,
+			LockTime: o.lockTime,
+			Inputs:   inputs,
+			Outputs:  newOutputs(payments, accumulated-total, wallet.GetPubKeyHashFromAddress(changeAddress)),
 		}
-		inputs = append(inputs, input)
+		newTx.ID = newTx.CalcID()
+		if err := u.SignTransactionWithWallets(newTx, wallets); err != nil {
+			return nil, err
+		}
+		return newTx, nil
+	})
+}
+
+// 合并某地址的零散UTXO：将最多maxInputs个UTXO汇总为一个输出，仍归该地址所有
+// maxInputs<=0时合并全部UTXO，手续费从合并后的输出中扣除
+func (u *UTXOSet) Consolidate(address string, w *wallet.Wallet, maxInputs int, opts ...TxOption) (*tx.Transaction, error) {
+	o := applyOptions(opts)
+	pubKeyHash := wallet.GetPubKeyHashFromAddress(address)
+	utxos := u.FindSpendableUTXO(pubKeyHash)
+	if maxInputs > 0 && len(utxos) > maxInputs {
+		// 优先合并金额最小的UTXO
+		slices.SortFunc(utxos, func(a, b UTXOOutput) int { return cmp.Compare(a.Value, b.Value) })
+		utxos = utxos[:maxInputs]
+	}
+	if len(utxos) < 2 {
+		return nil, errors.New("UTXO数量不足，无需合并")
+	}
+	var total tx.Amount
+	for _, out := range utxos {
+		total += out.Value
 	}
 
-	// 构造输出
-	outputs = append(outputs, tx.TXOutput{
-		Value:      amount,
-		PubKeyHash: wallet.GetPubKeyHashFromAddress(to),
+	return o.buildWithFee(func(fee tx.Amount) (*tx.Transaction, error) {
+		if total <= fee {
+			return nil, errors.New("UTXO总额不足以支付手续费")
+		}
+		newTx := &tx.Transaction{
+			ID:       nil,
+			Version:  tx.TxVersion,
+			LockTime: o.lockTime,
+			Inputs:   newInputs(utxos, w.PublicKey, o.sequence),
+			Outputs:  []tx.TXOutput{{Value: total - fee, PubKeyHash: pubKeyHash}},
+		}
+		newTx.ID = newTx.CalcID()
+		if err := u.SignTransaction(newTx, w.PrivateKey); err != nil {
+			return nil, err
+		}
+		return newTx, nil
 	})
-	if accumulated > amount {
-		// 找零
-		outputs = append(outputs, tx.TXOutput{
-			Value:      accumulated - amount,
-			PubKeyHash: pubKeyHash,
-		})
+}
+
+// 构造提高手续费的替换交易：输入、收款输出与原交易相同，从找零中扣除新增的手续费
+// 原交易的输入须全部属于钱包w，找零为付给w自身的输出
+func (u *UTXOSet) BumpFee(orig *tx.Transaction, fee tx.Amount, w *wallet.Wallet) (*tx.Transaction, error) {
+	in, err := u.replaceableInputs(orig, w)
+	if err != nil {
+		return nil, err
 	}
+	pubKeyHash := wallet.HashPubKey(w.PublicKey)
+	change := -1
+	var paid tx.Amount
+	for idx, out := range orig.Outputs {
+		if change < 0 && bytes.Equal(out.PubKeyHash, pubKeyHash) {
+			change = idx
+			continue
+		}
+		paid += out.Value
+	}
+	if change < 0 {
+		return nil, errors.New("原交易没有找零输出，无法提高手续费")
+	}
+	if in < paid+fee || in-paid-fee == 0 {
+		return nil, errors.New("找零不足以支付新的手续费")
+	}
+
+	newTx := cloneForReplacement(orig)
+	newTx.Outputs = slices.Clone(orig.Outputs)
+	newTx.Outputs[change].Value = in - paid - fee
+	newTx.ID = newTx.CalcID()
+	if err := u.SignTransaction(newTx, w.PrivateKey); err != nil {
+		return nil, err
+	}
+	return newTx, nil
+}
 
-	newTx := &tx.Transaction{
-		ID:      nil,
-		Inputs:  inputs,
-		Outputs: outputs,
+// 构造取消交易：花费原交易的全部输入，扣除手续费后全部退回钱包w
+func (u *UTXOSet) CancelTransaction(orig *tx.Transaction, fee tx.Amount, w *wallet.Wallet) (*tx.Transaction, error) {
+	in, err := u.replaceableInputs(orig, w)
+	if err != nil {
+		return nil, err
+	}
+	if in <= fee {
+		return nil, errors.New("输入总额不足以支付手续费")
 	}
+
+	newTx := cloneForReplacement(orig)
+	newTx.Outputs = []tx.TXOutput{{Value: in - fee, PubKeyHash: wallet.HashPubKey(w.PublicKey)}}
 	newTx.ID = newTx.CalcID()
-	// 签名
-	u.SignTransaction(newTx, w.PrivateKey)
+	if err := u.SignTransaction(newTx, w.PrivateKey); err != nil {
+		return nil, err
+	}
 	return newTx, nil
 }
 
-// 签名交易
-func (u *UTXOSet) SignTransaction(t *tx.Transaction, privKey *ecdsa.PrivateKey) {
+// 检查原交易的输入都属于钱包w，返回输入总额
+// 输入可以花费交易池中待确认交易的输出
+func (u *UTXOSet) replaceableInputs(orig *tx.Transaction, w *wallet.Wallet) (tx.Amount, error) {
+	if orig.IsCoinbase() {
+		return 0, errors.New("Coinbase交易不能被替换")
+	}
+	var total tx.Amount
+	for _, vin := range orig.Inputs {
+		if !bytes.Equal(vin.PubKey, w.PublicKey) {
+			return 0, errors.New("原交易包含不属于该钱包的输入")
+		}
+		prev, err := u.prevOutput(vin.Txid, vin.Vout)
+		if err != nil {
+			return 0, err
+		}
+		total += prev.Value
+	}
+	return total, nil
+}
+
+// 查找输入引用的输出：链上的未花费输出，或交易池中待确认交易的输出
+func (u *UTXOSet) prevOutput(txid []byte, vout int) (tx.TXOutput, error) {
+	if prev, ok := u.Blockchain.GetUTXO(txid, vout); ok {
+		return prev.TXOutput, nil
+	}
+	if u.Pool != nil {
+		if t := u.Pool.GetTx(txid); t != nil && vout >= 0 && vout < len(t.Outputs) {
+			return t.Outputs[vout], nil
+		}
+	}
+	return tx.TXOutput{}, fmt.Errorf("找不到输入 %x:%d", txid, vout)
+}
+
+// 复制原交易的版本、时间锁与输入（不含签名），供构造替换交易
+func cloneForReplacement(orig *tx.Transaction) *tx.Transaction {
+	inputs := slices.Clone(orig.Inputs)
+	for i := range inputs {
+		inputs[i].Signature = nil
+	}
+	return &tx.Transaction{
+		Version:  orig.Version,
+		Inputs:   inputs,
+		LockTime: orig.LockTime,
+	}
+}
+
+// 按手续费选项构造交易：先按固定手续费构造，
+// 若按费率计算出的手续费更高，则以该手续费重新构造，直到手续费足够
+func (o txOptions) buildWithFee(build func(fee tx.Amount) (*tx.Transaction, error)) (*tx.Transaction, error) {
+	fee := o.fee
+	for {
+		t, err := build(fee)
+		if err != nil {
+			return nil, err
+		}
+		required := tx.FeeForSize(o.feeRate, t.Size())
+		if fee >= required {
+			return t, nil
+		}
+		fee = required
+	}
+}
+
+// 检查付款列表并返回总金额
+func sumPayments(payments []Payment) (tx.Amount, error) {
+	if len(payments) == 0 {
+		return 0, errors.New("没有收款方")
+	}
+	var total tx.Amount
+	for _, p := range payments {
+		if p.Amount <= 0 {
+			return 0, errors.New("金额必须为正数")
+		}
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// 由选中的UTXO构造交易输入，签名后面再加
+func newInputs(utxos []UTXOOutput, pubKey []byte, sequence uint32) []tx.TXInput {
+	var inputs []tx.TXInput
+	for _, utxo := range utxos {
+		inputs = append(inputs, tx.TXInput{
+			Txid:      utxo.TxID,
+			Vout:      utxo.Vout,
+			Signature: nil,
+			PubKey:    pubKey,
+			Sequence:  sequence,
+		})
+	}
+	return inputs
+}
+
+// 由付款列表构造输出，change>0时找零给changePubKeyHash
+func newOutputs(payments []Payment, change tx.Amount, changePubKeyHash []byte) []tx.TXOutput {
+	var outputs []tx.TXOutput
+	for _, p := range payments {
+		outputs = append(outputs, tx.TXOutput{
+			Value:      p.Amount,
+			PubKeyHash: wallet.GetPubKeyHashFromAddress(p.To),
+		})
+	}
+	if change > 0 {
+		outputs = append(outputs, tx.TXOutput{
+			Value:      change,
+			PubKeyHash: changePubKeyHash,
+		})
+	}
+	return outputs
+}
+
+// 签名交易，任一输入引用的输出找不到时返回错误
+func (u *UTXOSet) SignTransaction(t *tx.Transaction, privKey *ecdsa.PrivateKey) error {
 	if t.IsCoinbase() {
-		return
+		return nil
+	}
+	for idx := range t.Inputs {
+		if err := u.signInput(t, idx, privKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 用多个钱包签名交易，每个输入使用公钥与之匹配的钱包
+func (u *UTXOSet) SignTransactionWithWallets(t *tx.Transaction, wallets []*wallet.Wallet) error {
+	if t.IsCoinbase() {
+		return nil
 	}
 	for idx, vin := range t.Inputs {
-		prevTx := u.Blockchain.FindTx(vin.Txid)
-		if prevTx == nil {
-			continue
+		i := slices.IndexFunc(wallets, func(w *wallet.Wallet) bool { return bytes.Equal(w.PublicKey, vin.PubKey) })
+		if i < 0 {
+			return fmt.Errorf("输入 %x:%d 没有对应的钱包", vin.Txid, vin.Vout)
 		}
-		// 只对当前输入引用的输出做签名
-		// 签名内容为PubKeyHash+TxID
-		dataToSign := append(prevTx.Outputs[vin.Vout].PubKeyHash, t.ID...)
-		hash := sha256.Sum256(dataToSign)
-		r, s, err := ecdsa.Sign(rand.Reader, privKey, hash[:])
-		if err != nil {
-			// 打印签名错误
-			println("签名失败:", err.Error())
-			continue
+		if err := u.signInput(t, idx, wallets[i].PrivateKey); err != nil {
+			return err
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
-		t.Inputs[idx].Signature = signature
 	}
+	return nil
+}
+
+// 签名单个输入，引用的输出可以在链上或交易池中
+func (u *UTXOSet) signInput(t *tx.Transaction, idx int, privKey *ecdsa.PrivateKey) error {
+	vin := t.Inputs[idx]
+	prev, err := u.prevOutput(vin.Txid, vin.Vout)
+	if err != nil {
+		return err
+	}
+	// 只对当前输入引用的输出做签名
+	// 签名内容为PubKeyHash+TxID
+	dataToSign := append(slices.Clone(prev.PubKeyHash), t.ID...)
+	hash := sha256.Sum256(dataToSign)
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash[:])
+	if err != nil {
+		return fmt.Errorf("签名失败: %w", err)
+	}
+	// r、s各补齐为定长，验证时按长度对半拆分
+	size := (privKey.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	t.Inputs[idx].Signature = signature
+	return nil
 }
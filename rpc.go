@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/miner"
+)
+
+// 矿工RPC的默认监听地址
+const defaultRPCAddr = "127.0.0.1:8765"
+
+// RPC返回的矿工状态
+type minerStatus struct {
+	Running     bool    `json:"running"`
+	Address     string  `json:"address"`
+	BlocksMined int     `json:"blocksMined"`
+	LastBlock   string  `json:"lastBlock"`
+	HashRate    float64 `json:"hashRate"`
+	PoolSize    int     `json:"poolSize"`
+	LastError   string  `json:"lastError,omitempty"`
+	Evicted     int     `json:"evicted"`
+}
+
+func newMinerStatus(st miner.Status) minerStatus {
+	status := minerStatus{
+		Running:     st.Running,
+		Address:     st.Address,
+		BlocksMined: st.BlocksMined,
+		LastBlock:   hex.EncodeToString(st.LastBlock[:]),
+		HashRate:    st.HashRate,
+		PoolSize:    st.PoolSize,
+		Evicted:     st.Evicted,
+	}
+	if st.LastError != nil {
+		status.LastError = st.LastError.Error()
+	}
+	return status
+}
+
+func printMinerStatus(st minerStatus) {
+	fmt.Printf("运行中: %v\n奖励地址: %s\n已挖区块: %d\n最近区块: %s\n算力: %.0f 次/秒\n交易池: %d 笔\n",
+		st.Running, st.Address, st.BlocksMined, st.LastBlock, st.HashRate, st.PoolSize)
+	if st.LastError != "" {
+		fmt.Println("最近错误:", st.LastError)
+	}
+	if st.Evicted > 0 {
+		fmt.Printf("因区块被拒绝移出交易池: %d 笔\n", st.Evicted)
+	}
+}
+
+// 后台矿工：start 在前台运行矿工并提供RPC，status/stop 通过RPC访问运行中的矿工
+func cmdMiner(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: miner start|stop|status [参数]")
+	}
+	fs := flag.NewFlagSet("miner "+args[0], flag.ContinueOnError)
+	rpcAddr := fs.String("rpc", defaultRPCAddr, "矿工RPC的监听或连接地址")
+	var cfg miner.Config
+	if args[0] == "start" {
+		fs.StringVar(&cfg.Address, "addr", "", "Coinbase奖励地址")
+		fs.IntVar(&cfg.MaxTxs, "max-txs", 0, "每个区块最多打包的交易数，0表示不限制")
+		fs.BoolVar(&cfg.MineEmpty, "empty", false, "交易池为空时也挖只含Coinbase的区块")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "start":
+		return runMiner(cfg, *rpcAddr)
+	case "status":
+		var st minerStatus
+		if err := callRPC(http.MethodGet, *rpcAddr, "/miner/status", &st); err != nil {
+			return err
+		}
+		printMinerStatus(st)
+		return nil
+	case "stop":
+		var st minerStatus
+		if err := callRPC(http.MethodPost, *rpcAddr, "/miner/stop", &st); err != nil {
+			return err
+		}
+		fmt.Printf("矿工已停止，共挖出%d个区块\n", st.BlocksMined)
+		return nil
+	default:
+		return fmt.Errorf("未知的矿工命令: %s", args[0])
+	}
+}
+
+// 打开数据库并启动矿工，直到收到 miner stop 或中断信号
+func runMiner(cfg miner.Config, rpcAddr string) error {
+	ab = accountbook.NewAccountBook(dbPath)
+	defer ab.Chain.Close()
+	m := miner.New(ab.Chain, ab.Pool, cfg)
+	if err := m.Start(); err != nil {
+		return err
+	}
+	ab.Miner = m
+
+	stop := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /miner/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, newMinerStatus(m.Status()))
+	})
+	mux.HandleFunc("POST /miner/stop", func(w http.ResponseWriter, r *http.Request) {
+		m.Stop()
+		writeJSON(w, newMinerStatus(m.Status()))
+		select {
+		case stop <- struct{}{}:
+		default:
+		}
+	})
+	server := &http.Server{Addr: rpcAddr, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	fmt.Printf("矿工已启动，奖励地址 %s，RPC监听 %s\n", cfg.Address, rpcAddr)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	var err error
+	select {
+	case <-stop:
+	case <-interrupt:
+	case err = <-serveErr:
+	}
+	m.Stop()
+	server.Close()
+	fmt.Printf("矿工已停止，共挖出%d个区块\n", m.Status().BlocksMined)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// 调用矿工RPC并解析返回的JSON
+func callRPC(method, rpcAddr, path string, result any) error {
+	req, err := http.NewRequest(method, "http://"+rpcAddr+path, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法连接矿工RPC（矿工是否已用 miner start 启动？）: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("矿工RPC返回 %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
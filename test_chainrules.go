@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
+)
+
+// 通过账本的公开接口出块，确认本地出块与区块校验遵循同一套规则
+func TestLocalBlocks() {
+	// 1. 按菜单的方式出块：领取奖励、不指定矿工的转账、一次提交多笔Coinbase、指定矿工的转账
+	fmt.Println("【1. 通过账本出块】")
+	ab, a, b, ok := buildLocalChain()
+	if !ok {
+		return
+	}
+	defer ab.Chain.Close()
+	fmt.Printf("    高度%d，A余额%s，B余额%s\n", len(ab.Chain.GetBlocks())-1, ab.GetBalance(a), ab.GetBalance(b))
+	// A领取3次奖励后转出50，B领取1次奖励、收到50并获得1次挖矿奖励
+	if ab.GetBalance(a) != 250*tx.Coin || ab.GetBalance(b) != 250*tx.Coin {
+		fmt.Println("    余额错误，A、B均应为250")
+		return
+	}
+
+	// 2. 每个区块的第一笔交易都是Coinbase，且只有这一笔
+	fmt.Println("【2. 检查Coinbase位置】")
+	for height, block := range ab.Chain.GetBlocks() {
+		for i, t := range block.Transactions {
+			if t.IsCoinbase() != (i == 0) {
+				fmt.Printf("    区块 #%d 的第%d笔交易Coinbase位置错误\n", height, i)
+				return
+			}
+		}
+	}
+	fmt.Println("    所有区块只有第一笔交易是Coinbase")
+
+	// 3. 完整校验整条链
+	fmt.Println("【3. 完整校验】")
+	if err := ab.Chain.VerifyChain(blockchain.VerifyUTXO); err != nil {
+		fmt.Println("    校验失败:", err)
+		return
+	}
+	fmt.Println("    校验通过")
+
+	// 4. 出块前向同一地址创建的两笔默认奖励交易ID不同，都能上链
+	fmt.Println("【4. 同一高度的两笔奖励】")
+	c1, c2 := ab.NewCoinbaseTx(b, ""), ab.NewCoinbaseTx(b, "")
+	if bytes.Equal(c1.ID, c2.ID) {
+		fmt.Println("    两笔奖励交易ID相同")
+		return
+	}
+	balance := ab.GetBalance(b)
+	if err := ab.AddBlock([]*tx.Transaction{c1, c2}, ""); err != nil || ab.GetBalance(b) != balance+2*tx.BlockSubsidy {
+		fmt.Println("    两笔奖励应都上链:", err)
+		return
+	}
+	fmt.Printf("    两笔奖励都已上链，高度%d\n", len(ab.Chain.GetBlocks())-1)
+
+	// 5. 与链上交易ID相同的Coinbase被丢弃并报告，不放回交易池
+	fmt.Println("【5. 重复的交易ID】")
+	height := len(ab.Chain.GetBlocks()) - 1
+	dup := ab.Chain.GetBlocks()[1].Transactions[0]
+	err := ab.AddBlock([]*tx.Transaction{dup}, "")
+	var rejected *blockchain.RejectedError
+	if !errors.As(err, &rejected) || len(rejected.Rejected) != 1 || len(ab.Chain.GetBlocks())-1 != height || ab.Pool.HasTx(dup.ID) {
+		fmt.Println("    重复交易ID的Coinbase应被丢弃并报告，实际:", err)
+		return
+	}
+	fmt.Println("    重复交易ID的Coinbase被丢弃:", rejected.Rejected[0].Err)
+
+	// 6. 时间戳超前本地时间过多、或不大于最近区块中位时间的区块被拒绝
+	fmt.Println("【6. 区块时间戳】")
+	future := time.Now().Add(blockchain.MaxFutureBlockTime*time.Second + time.Hour)
+	if err := mineAt(ab, a, future); !errors.Is(err, blockchain.ErrTimeTooNew) {
+		fmt.Println("    时间戳超前的区块应被拒绝，实际:", err)
+		return
+	}
+	fmt.Println("    时间戳超前的区块被拒绝")
+	mtp := time.Unix(int64(ab.Chain.MedianTimePast()), 0)
+	if err := mineAt(ab, a, mtp); !errors.Is(err, blockchain.ErrTimeTooOld) {
+		fmt.Println("    时间戳等于中位时间的区块应被拒绝，实际:", err)
+		return
+	}
+	fmt.Println("    时间戳等于中位时间的区块被拒绝")
+	if len(ab.Chain.GetBlocks())-1 != height {
+		fmt.Println("    被拒绝的区块不应接入链尾")
+		return
+	}
+
+	// 7. 交易池中的Coinbase与付手续费的转账一起提交：Coinbase单独成块，转账所在区块的Coinbase领取手续费
+	fmt.Println("【7. 奖励与转账一起出块】")
+	wc := wallet.NewWallet()
+	c, d := ab.GetAddress(wc), ab.GetAddress(wallet.NewWallet())
+	// C领取奖励后再出一块，使C的奖励成熟
+	for _, miner := range []string{c, a} {
+		if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(miner, "")}, ""); err != nil {
+			fmt.Println("    添加区块失败:", err)
+			return
+		}
+	}
+	height = len(ab.Chain.GetBlocks()) - 1
+	t, err := ab.CreateTransaction(c, a, 10*tx.Coin, wc, utxo.WithFee(tx.Coin))
+	if err == nil {
+		err = ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(a, ""), t}, d)
+	}
+	if err != nil {
+		fmt.Println("    出块失败:", err)
+		return
+	}
+	blocks := ab.Chain.GetBlocks()
+	if len(blocks)-1 != height+2 || len(blocks[height+1].Transactions) != 1 || !bytes.Equal(blocks[height+2].Transactions[1].ID, t.ID) {
+		fmt.Println("    奖励与转账应各自成块")
+		return
+	}
+	if ab.GetBalance(d) != tx.BlockSubsidy+tx.Coin {
+		fmt.Printf("    D余额%s，应为挖矿奖励与手续费之和\n", ab.GetBalance(d))
+		return
+	}
+	fmt.Printf("    高度%d，D余额%s，手续费由转账所在区块的Coinbase领取\n", len(blocks)-1, ab.GetBalance(d))
+}
+
+// 本地出块的链导出后再导入、通过快照启动并验证历史
+// 链中包含不指定矿工的转账区块与一次提交多笔Coinbase得到的区块
+func TestChainFile() {
+	// 1. 导出区块文件并导入新链
+	fmt.Println("【1. 导出并导入区块文件】")
+	ab, _, _, ok := buildLocalChain()
+	if !ok {
+		return
+	}
+	defer ab.Chain.Close()
+	var file bytes.Buffer
+	if err := ab.Chain.ExportChain(&file); err != nil {
+		fmt.Println("    导出失败:", err)
+		return
+	}
+	imported, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), ab.Chain.Net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer imported.Close()
+	n, err := imported.ImportChain(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		fmt.Printf("    导入%d个区块后失败: %v\n", n, err)
+		return
+	}
+	if n != len(ab.Chain.GetBlocks())-1 || imported.UTXOCommitment() != ab.Chain.UTXOCommitment() {
+		fmt.Printf("    导入%d个区块，与原链不一致\n", n)
+		return
+	}
+	fmt.Printf("    导入%d个区块，未花费输出与原链一致\n", n)
+
+	// 2. 从快照启动，再用区块文件验证历史
+	fmt.Println("【2. 快照启动与历史验证】")
+	var snapshot bytes.Buffer
+	commitment, err := ab.Chain.WriteUTXOSnapshot(&snapshot)
+	if err != nil {
+		fmt.Println("    写出快照失败:", err)
+		return
+	}
+	fromSnapshot, err := blockchain.NewBlockchainFromSnapshot(db.NewMemStore(), &snapshot, commitment, ab.Chain.Net)
+	if err != nil {
+		fmt.Println("    加载快照失败:", err)
+		return
+	}
+	defer fromSnapshot.Close()
+	if err := fromSnapshot.VerifyHistory(bytes.NewReader(file.Bytes())); err != nil {
+		fmt.Println("    历史验证失败:", err)
+		return
+	}
+	fmt.Printf("    快照承诺哈希%x，历史验证通过\n", commitment)
+}
+
+// 用账本的公开接口构造一条包含各类本地区块的链，返回账本与两个地址
+func buildLocalChain() (*accountbook.AccountBook, string, string, bool) {
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), blockchain.TestNet)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return nil, "", "", false
+	}
+	ab := accountbook.NewAccountBookWithChain(chain)
+	wa, wb := wallet.NewWallet(), wallet.NewWallet()
+	a, b := ab.GetAddress(wa), ab.GetAddress(wb)
+
+	steps := []struct {
+		name  string
+		txs   func() ([]*tx.Transaction, error)
+		miner string
+	}{
+		{"A领取奖励", func() ([]*tx.Transaction, error) { return []*tx.Transaction{ab.NewCoinbaseTx(a, "")}, nil }, ""},
+		{"A再次领取奖励", func() ([]*tx.Transaction, error) { return []*tx.Transaction{ab.NewCoinbaseTx(a, "")}, nil }, ""},
+		{"A、B在一次提交中各领取奖励", func() ([]*tx.Transaction, error) {
+			return []*tx.Transaction{ab.NewCoinbaseTx(a, "reward 3"), ab.NewCoinbaseTx(b, "reward 4")}, nil
+		}, ""},
+		{"A向B转账，不指定矿工", func() ([]*tx.Transaction, error) {
+			t, err := ab.CreateTransaction(a, b, 30*tx.Coin, wa)
+			return []*tx.Transaction{t}, err
+		}, ""},
+		{"A向B转账，奖励发往B", func() ([]*tx.Transaction, error) {
+			t, err := ab.CreateTransaction(a, b, 20*tx.Coin, wa)
+			return []*tx.Transaction{t}, err
+		}, b},
+	}
+	for _, step := range steps {
+		txs, err := step.txs()
+		if err == nil {
+			err = ab.AddBlock(txs, step.miner)
+		}
+		if err != nil {
+			fmt.Printf("    %s失败: %v\n", step.name, err)
+			chain.Close()
+			return nil, "", "", false
+		}
+	}
+	return ab, a, b, true
+}
+
+// 断开链尾区块后，交易池中花费了已不存在输出的交易被移除，其余交易保持父交易在前
+func TestDisconnect() {
+	// 1. A领取奖励；A向B转账30（不付手续费，如菜单4直接出块时），奖励发往B
+	fmt.Println("【1. 出块】")
+	net := *blockchain.TestNet
+	net.CoinbaseMaturity = 0
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), &net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
+	ab := accountbook.NewAccountBookWithChain(chain)
+	wa, wb := wallet.NewWallet(), wallet.NewWallet()
+	a, b := ab.GetAddress(wa), ab.GetAddress(wb)
+	if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(a, "")}, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	t1, err := ab.CreateTransaction(a, b, 30*tx.Coin, wa, utxo.WithFee(0))
+	if err == nil {
+		err = ab.AddBlock([]*tx.Transaction{t1}, b)
+	}
+	if err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+
+	// 2. 交易池：A花费t1的找零；B花费t1的输出与链尾区块的Coinbase
+	fmt.Println("【2. 提交交易】")
+	p0, err := ab.CreateTransaction(a, b, 10*tx.Coin, wa, utxo.WithFee(tx.Coin/10))
+	if err == nil {
+		err = ab.SubmitTx(p0)
+	}
+	if err != nil {
+		fmt.Println("    提交A->B失败:", err)
+		return
+	}
+	p1, err := ab.CreateTransaction(b, a, 120*tx.Coin, wb, utxo.WithFee(tx.Coin/10))
+	if err == nil {
+		err = ab.SubmitTx(p1)
+	}
+	if err != nil {
+		fmt.Println("    提交B->A失败:", err)
+		return
+	}
+
+	// 3. 断开链尾区块：不付手续费的t1也回到交易池且排在p0之前，p1花费的Coinbase已不存在
+	fmt.Println("【3. 断开链尾区块】")
+	_, dropped, err := ab.DisconnectTip()
+	if err != nil {
+		fmt.Println("    断开失败:", err)
+		return
+	}
+	pool := ab.Pool.GetTransactions()
+	if len(pool) != 2 || !bytes.Equal(pool[0].ID, t1.ID) || !bytes.Equal(pool[1].ID, p0.ID) {
+		fmt.Printf("    交易池应为[t1 p0]，实际有%d笔交易\n", len(pool))
+		return
+	}
+	if len(dropped) != 1 || !bytes.Equal(dropped[0].ID, p1.ID) {
+		fmt.Printf("    应只移除p1，实际移除%d笔交易\n", len(dropped))
+		return
+	}
+	fmt.Println("    交易池为[t1 p0]，花费被断开Coinbase的p1已移除并返回")
+}
+
+// 花费交易池中待确认输出的交易可以签名，也可以提高手续费
+func TestUnconfirmedInputs() {
+	// 1. A领取奖励并向B转账，转账留在交易池中
+	fmt.Println("【1. 待确认的转账】")
+	net := *blockchain.TestNet
+	net.CoinbaseMaturity = 0
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), &net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
+	ab := accountbook.NewAccountBookWithChain(chain)
+	wa, wb := wallet.NewWallet(), wallet.NewWallet()
+	a, b := ab.GetAddress(wa), ab.GetAddress(wb)
+	if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(a, "")}, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	parent, err := ab.CreateTransaction(a, b, 30*tx.Coin, wa, utxo.WithFee(tx.Coin/10))
+	if err == nil {
+		err = ab.SubmitTx(parent)
+	}
+	if err != nil {
+		fmt.Println("    提交A->B失败:", err)
+		return
+	}
+
+	// 2. B花费尚未确认的输出，向A转账10，找零给自己
+	fmt.Println("【2. 花费待确认输出】")
+	child := &tx.Transaction{
+		Version: tx.TxVersion,
+		Inputs:  []tx.TXInput{{Txid: parent.ID, Vout: 0, PubKey: wb.PublicKey, Sequence: tx.SequenceMaxReplaceable}},
+		Outputs: []tx.TXOutput{
+			{Value: 10 * tx.Coin, PubKeyHash: wallet.HashPubKey(wa.PublicKey)},
+			{Value: 20*tx.Coin - tx.Coin/10, PubKeyHash: wallet.HashPubKey(wb.PublicKey)},
+		},
+	}
+	child.ID = child.CalcID()
+	if err := ab.UTXOSet.SignTransaction(child, wb.PrivateKey); err != nil {
+		fmt.Println("    签名失败:", err)
+		return
+	}
+	if err := ab.SubmitTx(child); err != nil {
+		fmt.Println("    提交B->A失败:", err)
+		return
+	}
+	fmt.Println("    子交易签名并进入交易池")
+
+	// 3. 提高子交易的手续费
+	fmt.Println("【3. 提高手续费】")
+	bumped, err := ab.BumpFee(child.ID, wb, tx.Coin)
+	if err != nil {
+		fmt.Println("    提高手续费失败:", err)
+		return
+	}
+	if ab.Pool.HasTx(child.ID) || !ab.Pool.HasTx(bumped.ID) {
+		fmt.Println("    替换交易应取代原交易")
+		return
+	}
+	fmt.Printf("    替换交易手续费%s\n", ab.Pool.TxFee(chain, bumped))
+
+	// 4. 找不到输入时签名返回错误
+	fmt.Println("【4. 找不到输入】")
+	orphan := &tx.Transaction{
+		Version: tx.TxVersion,
+		Inputs:  []tx.TXInput{{Txid: make([]byte, 32), Vout: 0, PubKey: wb.PublicKey}},
+		Outputs: []tx.TXOutput{{Value: tx.Coin, PubKeyHash: wallet.HashPubKey(wa.PublicKey)}},
+	}
+	orphan.ID = orphan.CalcID()
+	err = ab.UTXOSet.SignTransaction(orphan, wb.PrivateKey)
+	if err == nil {
+		fmt.Println("    输入不存在时签名应失败")
+		return
+	}
+	fmt.Println("    签名失败:", err)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
+)
+
+func TestCoinSelection() {
+	// 1. 构造一组候选UTXO：若干零散小额 + 几笔大额
+	fmt.Println("【1. 构造候选UTXO】")
+	values := []tx.Amount{1, 2, 3, 5, 8, 13, 40, 60, 100, 250}
+	var utxos []utxo.UTXOOutput
+	for i, v := range values {
+		utxos = append(utxos, utxo.UTXOOutput{TxID: []byte{byte(i)}, Vout: 0, Value: v})
+	}
+	fmt.Printf("    候选金额: %v\n", values)
+
+	// 2. 用各策略选币，比较输入数量和找零
+	fmt.Println("【2. 比较各选币策略】")
+	selectors := []struct {
+		name     string
+		selector utxo.CoinSelector
+	}{
+		{"链上顺序", utxo.ChainOrder{}},
+		{"最大优先", utxo.LargestFirst{}},
+		{"最小优先", utxo.SmallestFirst{}},
+		{"分支定界", utxo.BranchAndBound{}},
+		{"随机改进", utxo.RandomImprove{Rand: rand.New(rand.NewSource(1))}},
+	}
+	for _, target := range []tx.Amount{21, 110, 400} {
+		fmt.Printf("    目标金额 %s:\n", target)
+		for _, s := range selectors {
+			sum, selected := s.selector.Select(utxos, target)
+			if sum < target {
+				fmt.Printf("    %s 选币失败，总额%s不足%s\n", s.name, sum, target)
+				return
+			}
+			fmt.Printf("      %s: 输入%d个，找零%s\n", s.name, len(selected), sum-target)
+		}
+	}
+
+	// 3. 验证各策略的预期特性
+	fmt.Println("【3. 验证策略特性】")
+	if _, selected := (utxo.LargestFirst{}).Select(utxos, 110); len(selected) != 1 {
+		fmt.Printf("    最大优先应只用1个输入，实际%d个\n", len(selected))
+		return
+	}
+	if sum, _ := (utxo.BranchAndBound{}).Select(utxos, 21); sum != 21 {
+		fmt.Printf("    分支定界应精确匹配21，实际%s\n", sum)
+		return
+	}
+	if sum, _ := (utxo.BranchAndBound{}).Select(utxos, 110); sum != 110 {
+		fmt.Printf("    分支定界应精确匹配110，实际%s\n", sum)
+		return
+	}
+	// 无法精确匹配时回退到最大优先
+	coarse := []utxo.UTXOOutput{{Value: 10}, {Value: 20}}
+	if sum, selected := (utxo.BranchAndBound{}).Select(coarse, 15); sum != 20 || len(selected) != 1 {
+		fmt.Printf("    分支定界回退结果错误：总额%s，输入%d个\n", sum, len(selected))
+		return
+	}
+	_, small := (utxo.SmallestFirst{}).Select(utxos, 110)
+	_, large := (utxo.LargestFirst{}).Select(utxos, 110)
+	if len(small) <= len(large) {
+		fmt.Println("    最小优先的输入数量应多于最大优先")
+		return
+	}
+	// 前6个候选中有大于目标的13，随机选取阶段的总额最多为9+13=22，改进阶段追加输入后总额仍不超过3倍目标
+	for i := 0; i < 20; i++ {
+		sum, _ := (utxo.RandomImprove{}).Select(utxos[:6], 10)
+		if sum < 10 || sum > 3*10 {
+			fmt.Printf("    随机改进总额%s超出[10, 30]\n", sum)
+			return
+		}
+	}
+	fmt.Println("    选币策略验证通过")
+}
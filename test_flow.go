@@ -7,13 +7,22 @@ import (
 	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
 )
 
 func TestUTXOFlow() {
 	// 1. 初始化区块链和UTXO集
 	fmt.Println("【1. 初始化区块链和UTXO集】")
-	chain := blockchain.NewBlockchain("data.test.db")
+	// 流程中会立即花费挖矿奖励，因此不要求Coinbase成熟
+	net := *blockchain.MainNet
+	net.CoinbaseMaturity = 0
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), &net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
 	utxoSet := utxo.UTXOSet{Blockchain: chain}
 
 	// 2. 创建两个钱包A、B
@@ -25,28 +34,31 @@ func TestUTXOFlow() {
 	fmt.Println("    A地址:", addrA)
 	fmt.Println("    B地址:", addrB)
 
-	// 3. 创建Coinbase交易给B，打包进区块链
-	fmt.Println("【3. 创建Coinbase交易给B，打包进区块链】")
-	coinbaseTx := tx.NewCoinbaseTX(addrB, "Hello")
+	// 3. 创建给A、B的Coinbase交易，各自作为一个区块的Coinbase打包进区块链
+	fmt.Println("【3. 创建给A、B的Coinbase交易，打包进区块链】")
 	pool := blockchain.TxPool{}
-	pool.AddTx(coinbaseTx)
-	chain.AddBlock(&pool, addrA)
-	fmt.Println("    添加Coinbase交易到区块链，A应获得100")
+	pool.AddTx(tx.NewCoinbaseTX(addrA, "Hello A"))
+	pool.AddTx(tx.NewCoinbaseTX(addrB, "Hello B"))
+	if err := chain.AddBlock(&pool, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	fmt.Println("    添加Coinbase交易到区块链，A、B应各获得100")
 
 	// 4. 查询A余额
 	fmt.Println("【4. 查询A余额】")
 	pubKeyHashA := wallet.GetPubKeyHashFromAddress(addrA)
-	utxosA, _ := utxoSet.FindSpendableOutputs(pubKeyHashA, 1000)
+	utxosA, _ := utxoSet.FindSpendableOutputs(pubKeyHashA, 1000*tx.Coin)
 	fmt.Printf("    A所有UTXO: %+v\n", utxoSet.FindUTXO(pubKeyHashA))
-	fmt.Printf("    A累计余额: %d\n", utxosA)
-	if utxosA < 100 {
-		fmt.Printf("    A余额不足，期望100，实际%d", utxosA)
+	fmt.Printf("    A累计余额: %s\n", utxosA)
+	if utxosA < 100*tx.Coin {
+		fmt.Printf("    A余额不足，期望100，实际%s", utxosA)
 		return
 	}
 
 	// 5. A向B转账40，构造交易，签名，验证签名
 	fmt.Println("【5. A向B转账40，构造交易，签名，验证签名】")
-	txAB, err := utxoSet.CreateTransaction(addrA, addrB, 40, walletA)
+	txAB, err := utxoSet.CreateTransaction(addrA, addrB, 40*tx.Coin, walletA)
 	if err != nil {
 		fmt.Printf("    创建A->B交易失败: %v", err)
 		return
@@ -62,24 +74,27 @@ func TestUTXOFlow() {
 	fmt.Println("【6. 打包A->B交易进新区块】")
 	pool2 := blockchain.TxPool{}
 	pool2.AddTx(txAB)
-	chain.AddBlock(&pool2, "")
+	if err := chain.AddBlock(&pool2, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
 	fmt.Println("    A->B交易已打包进新区块")
 
 	// 7. 查询A、B余额
 	fmt.Println("【7. 查询A、B余额】")
-	utxosA2, _ := utxoSet.FindSpendableOutputs(pubKeyHashA, 1000)
+	utxosA2, _ := utxoSet.FindSpendableOutputs(pubKeyHashA, 1000*tx.Coin)
 	pubKeyHashB := wallet.GetPubKeyHashFromAddress(addrB)
-	utxosB, _ := utxoSet.FindSpendableOutputs(pubKeyHashB, 1000)
+	utxosB, _ := utxoSet.FindSpendableOutputs(pubKeyHashB, 1000*tx.Coin)
 	fmt.Printf("    A所有UTXO: %+v\n", utxoSet.FindUTXO(pubKeyHashA))
 	fmt.Printf("    B所有UTXO: %+v\n", utxoSet.FindUTXO(pubKeyHashB))
-	fmt.Printf("    A累计余额: %d\n", utxosA2)
-	fmt.Printf("    B累计余额: %d\n", utxosB)
-	if utxosA2 != 60 {
-		fmt.Printf("    A余额错误，期望60，实际%d", utxosA2)
+	fmt.Printf("    A累计余额: %s\n", utxosA2)
+	fmt.Printf("    B累计余额: %s\n", utxosB)
+	if utxosA2 != 60*tx.Coin {
+		fmt.Printf("    A余额错误，期望60，实际%s", utxosA2)
 		return
 	}
-	if utxosB != 140 {
-		fmt.Printf("    B余额错误，期望140，实际%d", utxosB)
+	if utxosB != 140*tx.Coin {
+		fmt.Printf("    B余额错误，期望140，实际%s", utxosB)
 		return
 	}
 
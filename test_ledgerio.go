@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/ledgerio"
+)
+
+// CSV导入：试运行只计可花费余额，逐行记录所在高度，备注可以导出
+func TestImport() {
+	// 1. A领取奖励，奖励尚未成熟
+	fmt.Println("【1. 领取奖励】")
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), blockchain.TestNet)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
+	ab := accountbook.NewAccountBookWithChain(chain)
+	wa, wb := wallet.NewWallet(), wallet.NewWallet()
+	a, b := ab.GetAddress(wa), ab.GetAddress(wb)
+	wallets := func(address string) *wallet.Wallet {
+		return map[string]*wallet.Wallet{a: wa, b: wb}[address]
+	}
+	if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(a, "")}, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	csv := fmt.Sprintf("from,to,amount,memo\n%s,%s,10,房租\n%s,%s,5,水电\n", a, b, a, b)
+
+	// 2. 试运行：未成熟的奖励不能花费
+	fmt.Println("【2. 试运行】")
+	results, err := ledgerio.ImportCSV(ab, strings.NewReader(csv), wallets, ledgerio.ImportOptions{DryRun: true})
+	if err != nil || len(results) != 2 || results[0].Err == nil {
+		fmt.Println("    未成熟的奖励不应计入可花费余额:", err)
+		return
+	}
+	fmt.Println("    第一行:", results[0].Err)
+
+	// 3. 奖励成熟后导入：同一转出地址的两行分别打包，各自记录高度与备注
+	fmt.Println("【3. 导入】")
+	if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(b, "")}, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	results, err = ledgerio.ImportCSV(ab, strings.NewReader(csv), wallets, ledgerio.ImportOptions{})
+	if err != nil {
+		fmt.Println("    导入失败:", err)
+		return
+	}
+	for i, r := range results {
+		if r.Err != nil || r.Height != 3+i {
+			fmt.Printf("    第%d行: 高度%d，错误%v，应在高度%d\n", r.Row.Line, r.Height, r.Err, 3+i)
+			return
+		}
+	}
+	fmt.Printf("    两行分别打包进区块 #%d、#%d\n", results[0].Height, results[1].Height)
+
+	// 4. 导出账目时带有备注
+	fmt.Println("【4. 导出备注】")
+	var out bytes.Buffer
+	if err := ledgerio.ExportHistory(&out, ab, []string{a}, ledgerio.FormatCSV); err != nil {
+		fmt.Println("    导出失败:", err)
+		return
+	}
+	if !strings.Contains(out.String(), "房租") || !strings.Contains(out.String(), "水电") {
+		fmt.Println("    导出的账目缺少备注:\n", out.String())
+		return
+	}
+	fmt.Println("    导出的账目包含备注")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/merkle"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+)
+
+// 比特币区块中的交易ID与Merkle根，按区块浏览器中的显示顺序（与内部字节序相反）
+var bitcoinMerkleVectors = []struct {
+	name  string
+	txids []string
+	root  string
+}{
+	{
+		name:  "创世块",
+		txids: []string{"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"},
+		root:  "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+	},
+	{
+		name: "区块100000",
+		txids: []string{
+			"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+			"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+			"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+			"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+		},
+		root: "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766",
+	},
+}
+
+func TestMerkle() {
+	// 1. 与比特币区块的Merkle根对比
+	fmt.Println("【1. 比特币区块的Merkle根】")
+	for _, v := range bitcoinMerkleVectors {
+		var hashes [][32]byte
+		for _, id := range v.txids {
+			hashes = append(hashes, displayHash(id))
+		}
+		root, mutated := merkle.BitcoinRoot(hashes)
+		if root != displayHash(v.root) || mutated {
+			fmt.Printf("    %s: 期望%s，实际%x（mutated=%v）\n", v.name, v.root, reversed(root), mutated)
+			return
+		}
+		fmt.Printf("    %s: %s\n", v.name, v.root)
+	}
+
+	// 2. 奇数个节点复制末尾节点，重复形式须被识别（CVE-2012-2459）
+	fmt.Println("【2. 奇数个节点与重复交易】")
+	var hashes [][32]byte
+	for _, id := range bitcoinMerkleVectors[1].txids[:3] {
+		hashes = append(hashes, displayHash(id))
+	}
+	odd, oddMutated := merkle.BitcoinRoot(hashes)
+	dup, dupMutated := merkle.BitcoinRoot(append(hashes, hashes[2]))
+	if odd != dup || oddMutated || !dupMutated {
+		fmt.Printf("    [a b c]与[a b c c]应有相同的根，且只有后者被标记: %v %v %v\n", odd == dup, oddMutated, dupMutated)
+		return
+	}
+	fmt.Printf("    [a b c]与[a b c c]的根均为%x，后者被标记为重复\n", reversed(odd))
+
+	// 3. 指针树与由叶节点哈希计算的BitcoinRoot结果一致
+	fmt.Println("【3. 指针树】")
+	w := wallet.NewWallet()
+	var txs []*tx.Transaction
+	var leaves [][32]byte
+	for i := range 5 {
+		t := tx.NewCoinbaseTX(w.GetAddress(), fmt.Sprintf("merkle %d", i))
+		txs = append(txs, t)
+		leaves = append(leaves, merkle.BitcoinLeaf(t))
+	}
+	root, _ := merkle.BitcoinRoot(leaves)
+	if tree := merkle.CreateTree(txs, merkle.Bitcoin); tree.Hash != root {
+		fmt.Printf("    指针树的根%x与%x不符\n", tree.Hash, root)
+		return
+	}
+	if merkle.CreateTree(txs).Hash == root {
+		fmt.Println("    Legacy与Bitcoin方式的根不应相同")
+		return
+	}
+	fmt.Printf("    5笔交易的根: %x\n", root)
+
+	// 4. 只计算哈希的Root与指针树结果一致，空交易列表的根为全零哈希
+	fmt.Println("【4. 只计算根】")
+	for _, mode := range []merkle.Mode{merkle.Legacy, merkle.Bitcoin} {
+		for n := 0; n <= len(txs); n++ {
+			root, mutated := merkle.Root(txs[:n], mode)
+			if tree := merkle.CreateTree(txs[:n], mode); root != tree.Hash || mutated {
+				fmt.Printf("    方式%d、%d笔交易: Root为%x，指针树为%x\n", mode, n, root, tree.Hash)
+				return
+			}
+		}
+	}
+	if root, _ := merkle.Root(nil); root != [32]byte{} {
+		fmt.Printf("    空交易列表的根应为全零哈希，实际%x\n", root)
+		return
+	}
+	fmt.Println("    0-5笔交易两种方式的结果一致，空交易列表的根为全零哈希")
+
+	// 5. 交易ID不含签名，Merkle根须承诺签名：只有签名不同的交易ID相同、根不同
+	fmt.Println("【5. 签名参与Merkle根】")
+	signed := &tx.Transaction{
+		Version: tx.TxVersion,
+		Inputs:  []tx.TXInput{{Txid: txs[0].ID, Vout: 0, Signature: []byte{1}, PubKey: w.PublicKey, Sequence: tx.SequenceFinal}},
+		Outputs: []tx.TXOutput{{Value: tx.Coin, PubKeyHash: wallet.HashPubKey(w.PublicKey)}},
+	}
+	signed.ID = signed.CalcID()
+	resigned := *signed
+	resigned.Inputs = []tx.TXInput{signed.Inputs[0]}
+	resigned.Inputs[0].Signature = []byte{2}
+	if !slices.Equal(resigned.CalcID(), signed.ID) {
+		fmt.Println("    只有签名不同的交易ID应相同")
+		return
+	}
+	for _, mode := range []merkle.Mode{merkle.Legacy, merkle.Bitcoin} {
+		a, _ := merkle.Root([]*tx.Transaction{txs[0], signed}, mode)
+		b, _ := merkle.Root([]*tx.Transaction{txs[0], &resigned}, mode)
+		if a == b {
+			fmt.Printf("    方式%d: 只有签名不同的交易列表Merkle根相同\n", mode)
+			return
+		}
+	}
+	fmt.Println("    两种方式下签名不同的交易列表Merkle根不同")
+
+	// 6. 使用比特币方式的网络：正常出块，拒绝重复形式的区块
+	fmt.Println("【6. 使用比特币Merkle根的网络】")
+	net := blockchain.TestNet.WithMerkleMode(merkle.Bitcoin, "test-btcmerkle", 0xacb00c03)
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
+	ab := accountbook.NewAccountBookWithChain(chain)
+	if err := ab.AddBlock([]*tx.Transaction{tx.NewCoinbaseTX(w.GetAddress(), "btc merkle")}, ""); err != nil {
+		fmt.Println("    添加区块失败:", err)
+		return
+	}
+	if err := chain.VerifyChain(blockchain.VerifyUTXO); err != nil {
+		fmt.Println("    校验失败:", err)
+		return
+	}
+	// 交易列表[cb a b]复制末尾交易得到[cb a b b]，两者的Merkle根相同
+	tmpl := chain.GetBlockTemplate(&blockchain.TxPool{}, 0)
+	block := tmpl.NewBlock(w.GetAddress())
+	a, b := tx.NewCoinbaseTX(w.GetAddress(), "extra a"), tx.NewCoinbaseTX(w.GetAddress(), "extra b")
+	block.Transactions = append(block.Transactions, a, b, b)
+	block.SetVersion(block.Version)
+	block.MineBlock()
+	err = chain.SubmitBlock(&block)
+	if !errors.Is(err, blockchain.ErrMutatedMerkle) {
+		fmt.Println("    含重复交易的区块应因重复形式被拒绝，实际:", err)
+		return
+	}
+	fmt.Println("    重复交易的区块被拒绝:", err)
+	fmt.Printf("    区块版本%d，高度%d，校验通过\n", chain.GetBlocks()[1].Version, len(chain.GetBlocks())-1)
+}
+
+// 按显示顺序解析哈希，转换为内部字节序
+func displayHash(s string) [32]byte {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		panic("无效的哈希: " + s)
+	}
+	slices.Reverse(b)
+	return [32]byte(b)
+}
+
+// 转换为显示顺序
+func reversed(h [32]byte) []byte {
+	b := h[:]
+	slices.Reverse(b)
+	return b
+}
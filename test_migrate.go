@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+)
+
+// 旧版本（版本0）的数据库：网络不符时拒绝打开且不做修改，网络相符时升级后正常打开
+// 创世块随启动时间生成的最初版本数据库无法升级，以明确的错误拒绝
+func TestMigration() {
+	// 1. 按版本0的布局写入TestNet的创世块
+	fmt.Println("【1. 构造版本0的数据库】")
+	dir, err := os.MkdirTemp("", "accountbook")
+	if err != nil {
+		fmt.Println("    创建临时目录失败:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.db")
+	if err := writeLegacyDB(path, blockchain.TestNet.GenesisBlock()); err != nil {
+		fmt.Println("    写入数据库失败:", err)
+		return
+	}
+	before, _ := os.ReadFile(path)
+
+	// 2. 按MainNet打开应被拒绝，文件保持原样
+	fmt.Println("【2. 网络不符时拒绝打开】")
+	err = openLedger(path, blockchain.MainNet)
+	if err == nil {
+		fmt.Println("    网络不符的数据库应被拒绝")
+		return
+	}
+	fmt.Println("    拒绝打开:", err)
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		fmt.Println("    被拒绝的数据库已被修改")
+		return
+	}
+	fmt.Println("    数据库文件未被修改")
+
+	// 3. 按TestNet打开，升级后链尾为创世块
+	fmt.Println("【3. 网络相符时升级】")
+	if err := openLedger(path, blockchain.TestNet); err != nil {
+		fmt.Println("    打开失败:", err)
+		return
+	}
+	fmt.Println("    升级并打开成功")
+
+	// 4. 最初版本的程序创建的数据库：创世块不含交易、时间戳为首次启动的时间，拒绝打开且不做修改
+	fmt.Println("【4. 创世块不固定的旧数据库】")
+	path = filepath.Join(dir, "baseline.db")
+	genesis := &pow.Block{Version: 2, Timestamp: uint32(time.Now().Unix()), Bits: pow.DefaultBits}
+	if err := writeLegacyDB(path, genesis); err != nil {
+		fmt.Println("    写入数据库失败:", err)
+		return
+	}
+	before, _ = os.ReadFile(path)
+	err = openLedger(path, blockchain.MainNet)
+	if !errors.Is(err, blockchain.ErrLegacyDatabase) {
+		fmt.Println("    旧数据库应以ErrLegacyDatabase拒绝，实际:", err)
+		return
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		fmt.Println("    被拒绝的数据库已被修改")
+		return
+	}
+	fmt.Println("    拒绝打开:", err)
+}
+
+// 以版本0的布局写入创世块：没有meta桶，链尾哈希保存在blocks桶的lastHash键下
+func writeLegacyDB(path string, genesis *pow.Block) error {
+	database, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(genesis); err != nil {
+		return err
+	}
+	hash := genesis.CalculateHash()
+	return database.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucket([]byte("blocks"))
+		if err != nil {
+			return err
+		}
+		if err := bkt.Put(hash[:], buf.Bytes()); err != nil {
+			return err
+		}
+		return bkt.Put([]byte("lastHash"), hash[:])
+	})
+}
+
+// 打开账本，把初始化时的panic转为错误
+func openLedger(path string, net *blockchain.Network) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	ab := accountbook.NewAccountBook(path, net)
+	if height := len(ab.Chain.GetBlocks()) - 1; height != 0 {
+		err = fmt.Errorf("链尾高度应为0，实际%d", height)
+	}
+	ab.Chain.Close()
+	return err
+}
+
+// 裁剪设置保存在数据库中，重新打开后接入新区块时自动裁剪
+func TestPrunePersist() {
+	// 1. 设置裁剪后关闭数据库
+	fmt.Println("【1. 保存裁剪设置】")
+	dir, err := os.MkdirTemp("", "accountbook")
+	if err != nil {
+		fmt.Println("    创建临时目录失败:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.db")
+	ab := accountbook.NewAccountBook(path, blockchain.TestNet)
+	if err := ab.Chain.SetPrune(&blockchain.PruneConfig{Depth: 1}); err != nil {
+		fmt.Println("    保存裁剪设置失败:", err)
+		ab.Chain.Close()
+		return
+	}
+	ab.Chain.Close()
+
+	// 2. 重新打开后出块，超出MinPruneKeep的旧区块被裁剪
+	fmt.Println("【2. 重新打开后出块】")
+	ab = accountbook.NewAccountBook(path, blockchain.TestNet)
+	defer ab.Chain.Close()
+	if ab.Chain.Prune == nil || ab.Chain.Prune.Depth != 1 {
+		fmt.Println("    重新打开后裁剪设置丢失")
+		return
+	}
+	miner := ab.GetAddress(wallet.NewWallet())
+	for range blockchain.MinPruneKeep + 2 {
+		if err := ab.AddBlock([]*tx.Transaction{ab.NewCoinbaseTx(miner, "")}, ""); err != nil {
+			fmt.Println("    添加区块失败:", err)
+			return
+		}
+	}
+	if want := len(ab.Chain.GetBlocks()) - blockchain.MinPruneKeep; ab.Chain.PruneHeight() != want {
+		fmt.Printf("    裁剪高度应为%d，实际%d\n", want, ab.Chain.PruneHeight())
+		return
+	}
+	fmt.Printf("    高度%d，高度低于%d的区块已被裁剪\n", len(ab.Chain.GetBlocks())-1, ab.Chain.PruneHeight())
+}
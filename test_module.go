@@ -8,6 +8,7 @@ import (
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/pow"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
 	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
 )
 
 func TestModules() {
@@ -42,11 +43,19 @@ func TestModules() {
 	fmt.Printf("Block mined: %x\n", myBlock.MineBlock())
 
 	// 区块链
-	myChain := blockchain.NewBlockchain("./database/data.test.db")
+	myChain, err := blockchain.NewBlockchainWithStore(db.NewMemStore())
+	if err != nil {
+		fmt.Println("初始化区块链失败:", err)
+		return
+	}
+	defer myChain.Close()
 	myPool := blockchain.TxPool{}
 
 	myPool.AddTx(myCoinbase)
-	myChain.AddBlock(&myPool, myWallet.GetAddress())
+	if err := myChain.AddBlock(&myPool, myWallet.GetAddress()); err != nil {
+		fmt.Println("添加区块失败:", err)
+		return
+	}
 	fmt.Println("---------\n区块链测试：")
 	myChain.Print()
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marshuni/Blockchain-AccountBook/pkg/accountbook"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/blockchain"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/tx"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/core/wallet"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/db"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/report"
+	"github.com/marshuni/Blockchain-AccountBook/pkg/utxo"
+)
+
+// 在一条跨越三个月的小链上检查A的收支表、月末余额与主要对手方
+func TestReport() {
+	// 1. 出块：7月A挖矿得100、向B转账30；8月B向A转账10；9月A向C转账20；每笔转账手续费0.1
+	fmt.Println("【1. 构造账目】")
+	net := *blockchain.TestNet
+	net.CoinbaseMaturity = 0
+	chain, err := blockchain.NewBlockchainWithStore(db.NewMemStore(), &net)
+	if err != nil {
+		fmt.Println("    初始化区块链失败:", err)
+		return
+	}
+	defer chain.Close()
+	ab := accountbook.NewAccountBookWithChain(chain)
+	wa, wb := wallet.NewWallet(), wallet.NewWallet()
+	a, b := ab.GetAddress(wa), ab.GetAddress(wb)
+	c, m := ab.GetAddress(wallet.NewWallet()), ab.GetAddress(wallet.NewWallet())
+	fee := utxo.WithFee(tx.Coin / 10)
+	steps := []struct {
+		date     time.Time
+		from, to string
+		w        *wallet.Wallet
+		amount   tx.Amount
+		miner    string
+	}{
+		{localNoon(2025, 7, 1), "", "", nil, 0, a},
+		{localNoon(2025, 7, 15), a, b, wa, 30 * tx.Coin, m},
+		{localNoon(2025, 8, 2), b, a, wb, 10 * tx.Coin, m},
+		{localNoon(2025, 9, 10), a, c, wa, 20 * tx.Coin, m},
+	}
+	for _, s := range steps {
+		if s.w != nil {
+			t, err := ab.CreateTransaction(s.from, s.to, s.amount, s.w, fee)
+			if err == nil {
+				err = ab.SubmitTx(t)
+			}
+			if err != nil {
+				fmt.Println("    提交交易失败:", err)
+				return
+			}
+		}
+		if err := mineAt(ab, s.miner, s.date); err != nil {
+			fmt.Println("    添加区块失败:", err)
+			return
+		}
+	}
+
+	r, err := report.New(ab, []string{a}, report.Monthly, 1)
+	if err != nil {
+		fmt.Println("    生成报表失败:", err)
+		return
+	}
+
+	// 2. 收支表：手续费单列，合计与余额一致
+	fmt.Println("【2. 收支表】")
+	want := map[string][3]tx.Amount{ // 笔数、收入、支出
+		report.CategoryMining:   {1, 100 * tx.Coin, 0},
+		report.CategoryReceive:  {1, 10 * tx.Coin, 0},
+		report.CategorySend:     {2, 0, 50 * tx.Coin},
+		report.CategoryInternal: {0, 0, 0},
+		report.CategoryFee:      {2, 0, tx.Coin / 5},
+		"total":                 {4, 110 * tx.Coin, 50*tx.Coin + tx.Coin/5},
+	}
+	for _, l := range r.Statement {
+		if w := want[l.Category]; tx.Amount(l.Count) != w[0] || l.Income != w[1] || l.Expense != w[2] {
+			fmt.Printf("    %s: %d笔，收入%s，支出%s，应为%d笔，收入%s，支出%s\n", l.Category, l.Count, l.Income, l.Expense, w[0], w[1], w[2])
+			return
+		}
+	}
+	if total := r.Statement[len(r.Statement)-1]; total.Net != ab.GetBalance(a) {
+		fmt.Printf("    合计净额%s与余额%s不符\n", total.Net, ab.GetBalance(a))
+		return
+	}
+	fmt.Println("    各分类合计正确，净额与余额一致")
+
+	// 3. 月末余额
+	fmt.Println("【3. 月末余额】")
+	balances := []report.BalancePoint{
+		{Period: "2025-07", Balance: 70*tx.Coin - tx.Coin/10},
+		{Period: "2025-08", Balance: 80*tx.Coin - tx.Coin/10},
+		{Period: "2025-09", Balance: 60*tx.Coin - tx.Coin/5},
+	}
+	if fmt.Sprint(r.Balances) != fmt.Sprint(balances) {
+		fmt.Printf("    月末余额应为%v，实际%v\n", balances, r.Balances)
+		return
+	}
+	fmt.Printf("    %v\n", r.Balances)
+
+	// 4. 主要对手方：B往来两笔共40，多于C的20
+	fmt.Println("【4. 主要对手方】")
+	top := r.Counterparties
+	if len(top) != 1 || top[0].Address != b || top[0].Count != 2 || top[0].Sent != 30*tx.Coin || top[0].Received != 10*tx.Coin {
+		fmt.Printf("    主要对手方应为B（2笔，付出30，收到10），实际%+v\n", top)
+		return
+	}
+	fmt.Printf("    B: %d笔，付出%s，收到%s\n", top[0].Count, top[0].Sent, top[0].Received)
+}
+
+// 用交易池中的交易按指定时间出块，Coinbase发往miner
+func mineAt(ab *accountbook.AccountBook, miner string, at time.Time) error {
+	tmpl := ab.Chain.GetBlockTemplate(ab.Pool, 0)
+	tmpl.CurTime = uint32(at.Unix())
+	block := tmpl.NewBlock(miner)
+	block.MineBlock()
+	return ab.SubmitBlock(&block)
+}
+
+// 当地时间的中午，避免时区影响所在的日期
+func localNoon(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.Local)
+}